@@ -2,20 +2,38 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"bskit/backend/auth"
 	"bskit/backend/dagger"
+	"bskit/backend/engine"
+	"bskit/backend/environment"
+	"bskit/backend/history"
+	"bskit/backend/load"
 	"bskit/backend/pack"
+	"bskit/backend/pipeline"
+	"bskit/backend/preview"
+	"bskit/backend/proxy"
 	"bskit/backend/repo"
+	"bskit/backend/run"
+	"bskit/backend/smoke"
+	"bskit/backend/watch"
 
 	"github.com/sqweek/dialog"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// Returned by the methods whose backend couldn't be initialized at startup
+var (
+	errDockerUnavailable = errors.New("Docker is not available")
+	errDaggerUnavailable = errors.New("Dagger is not available")
+)
+
 // TODO: refactor to use an interface based approach
 // App struct
 type App struct {
@@ -26,6 +44,16 @@ type App struct {
 	Auth         *auth.Auth
 	repo         *repo.RepoManager
 	daggerRunner *dagger.Runner
+	runManager   *run.RunManager
+	environments *environment.EnvironmentManager
+	watches      *watch.WatchManager
+	history      *history.HistoryStore
+	pipelines    *pipeline.PipelineRunner
+	proxy        *proxy.ProxyServer
+	previews     *preview.PreviewManager
+	smoke        *smoke.SmokeRunner
+	load         *load.LoadGenerator
+	engine       *engine.EngineWatcher
 }
 
 // NewApp creates a new App application struct
@@ -35,9 +63,15 @@ func NewApp() *App {
 		log.Printf("Failed to initialize repo manager: %v", err)
 		return nil
 	}
+	historyStore, err := history.NewHistoryStore()
+	if err != nil {
+		log.Printf("Failed to initialize build history: %v", err)
+		return nil
+	}
 	return &App{
 		readyChan: make(chan struct{}),
 		repo:      repoManager,
+		history:   historyStore,
 	}
 }
 
@@ -51,21 +85,23 @@ func (a *App) Startup(ctx context.Context) {
 
 	// Initialize auth with the correct context
 	a.Auth = auth.NewAuth(ctx)
+	a.repo.SetContext(ctx)
+	a.repo.SetTokenProvider(a.Auth.TokenForHost)
+	a.repo.SetHostKeyPrompt(func(host, keyType, fingerprint string) bool {
+		answer, err := runtime.MessageDialog(ctx, runtime.MessageDialogOptions{
+			Type:  runtime.QuestionDialog,
+			Title: "Unknown SSH host",
+			Message: fmt.Sprintf("The authenticity of %s can't be established.\n\n%s key fingerprint:\n%s\n\nTrust this host and remember its key?",
+				host, keyType, fingerprint),
+			Buttons:       []string{"Trust", "Cancel"},
+			DefaultButton: "Cancel",
+			CancelButton:  "Cancel",
+		})
+		return err == nil && (answer == "Trust" || answer == "Yes")
+	})
 
-	// Initialize pack builder
-	var err error
-	a.packBuilder, err = pack.NewPackBuilder(ctx)
-	if err != nil {
-		log.Printf("Failed to initialize pack builder: %v", err)
-		return
-	}
-
-	// Initialize dagger runner
-	a.daggerRunner, err = dagger.NewRunner(ctx)
-	if err != nil {
-		log.Printf("Failed to initialize dagger runner: %v", err)
-		return
-	}
+	// Frontend events are registered before the Docker and Dagger init below,
+	// which returns early when they are unavailable. The handlers report it.
 
 	// Set up event listener for when frontend connects
 	runtime.EventsOn(a.eventCtx, "build:ready", func(data ...interface{}) {
@@ -96,7 +132,22 @@ func (a *App) Startup(ctx context.Context) {
 		if len(data) > 0 {
 			if runData, ok := data[0].(map[string]interface{}); ok {
 				if imageName, ok := runData["imageName"].(string); ok {
-					if err := a.daggerRunner.RunContainer(imageName); err != nil {
+					processType, _ := runData["processType"].(string)
+					debug, _ := runData["debug"].(bool)
+					// Docker picks a free host port unless the payload maps one
+					ports := stringSlice(runData["ports"])
+					if len(ports) == 0 {
+						ports = []string{"3000"}
+					}
+					opts := run.Options{
+						Image:       imageName,
+						Ports:       ports,
+						ProcessType: processType,
+						Command:     stringSlice(runData["command"]),
+						Args:        stringSlice(runData["args"]),
+						Debug:       debug,
+					}
+					if _, err := a.RunImage(opts); err != nil {
 						runtime.EventsEmit(a.ctx, "build:log", fmt.Sprintf("Error: failed to run container: %v", err))
 					}
 				} else {
@@ -116,11 +167,88 @@ func (a *App) Startup(ctx context.Context) {
 		runtime.EventsEmit(a.ctx, "directory:selected", selectedDirectory)
 	})
 
+	// Initialize pack builder
+	var err error
+	a.packBuilder, err = pack.NewPackBuilder(ctx)
+	if err != nil {
+		log.Printf("Failed to initialize pack builder: %v", err)
+		return
+	}
+
+	// Initialize run manager and the environments built on top of it
+	a.runManager, err = run.NewRunManager(ctx)
+	if err != nil {
+		log.Printf("Failed to initialize run manager: %v", err)
+		return
+	}
+	a.environments = environment.NewEnvironmentManager(ctx, a.runManager)
+
+	// Keep the UI in sync with containers and images changed outside bskit
+	a.engine = engine.NewEngineWatcher(ctx, a.runManager.DockerClient())
+	a.engine.Start()
+
+	a.watches = watch.NewWatchManager(ctx, a.packBuilder, a.runManager)
+	a.smoke = smoke.NewSmokeRunner(ctx, a.runManager, a.history)
+	a.load = load.NewLoadGenerator(ctx, a.runManager)
+	a.previews = preview.NewPreviewManager(ctx, a.repo, a.packBuilder, a.runManager, a.history, a.smoke)
+
+	// Initialize the reverse proxy; apps stay reachable on their ports if it can't listen
+	if a.proxy, err = proxy.NewProxyServer(ctx, a.runManager); err != nil {
+		log.Printf("Failed to initialize proxy: %v", err)
+	} else if err := a.proxy.Start(proxy.DefaultConfig); err != nil {
+		log.Printf("Failed to start proxy: %v", err)
+	}
+
+	// Terminal input and resize events for exec sessions
+	runtime.EventsOn(a.eventCtx, "exec:input", func(data ...interface{}) {
+		if len(data) == 0 {
+			return
+		}
+		input, ok := data[0].(map[string]interface{})
+		if !ok {
+			return
+		}
+		sessionID, _ := input["sessionId"].(string)
+		text, _ := input["data"].(string)
+		if err := a.runManager.WriteExec(sessionID, text); err != nil {
+			log.Printf("Failed to write to exec session: %v", err)
+		}
+	})
+
+	runtime.EventsOn(a.eventCtx, "exec:resize", func(data ...interface{}) {
+		if len(data) == 0 {
+			return
+		}
+		size, ok := data[0].(map[string]interface{})
+		if !ok {
+			return
+		}
+		sessionID, _ := size["sessionId"].(string)
+		cols, _ := size["cols"].(float64)
+		rows, _ := size["rows"].(float64)
+		if err := a.runManager.ResizeExec(sessionID, uint(cols), uint(rows)); err != nil {
+			log.Printf("Failed to resize exec session: %v", err)
+		}
+	})
+
+	// Initialize dagger runner
+	a.daggerRunner, err = dagger.NewRunner(ctx)
+	if err != nil {
+		log.Printf("Failed to initialize dagger runner: %v", err)
+		return
+	}
+	a.pipelines = pipeline.NewPipelineRunner(ctx, a.daggerRunner, a.packBuilder, a.history)
+
 	fmt.Printf("Event listeners set up complete\n")
 }
 
 // StartBuild starts the build process using pack CLI
 func (a *App) StartBuild(data map[string]interface{}) {
+	if a.packBuilder == nil {
+		runtime.EventsEmit(a.ctx, "build:log", fmt.Sprintf("Error: %v.", errDockerUnavailable))
+		return
+	}
+
 	selectedDirectory, ok := data["selectedDirectory"].(string)
 	if !ok || selectedDirectory == "" {
 		runtime.EventsEmit(a.ctx, "build:log", "Error: No directory selected.")
@@ -140,10 +268,156 @@ func (a *App) StartBuild(data map[string]interface{}) {
 		return
 	}
 
+	record, err := a.history.StartBuild(absPath, filepath.Base(absPath), platform, repo.HeadCommit(absPath))
+	if err != nil {
+		log.Printf("Failed to record build: %v", err)
+	}
+
 	// Start the build process
-	if err := a.packBuilder.Build(absPath, platform); err != nil {
+	err = a.packBuilder.Build(absPath, platform)
+	if err != nil {
 		runtime.EventsEmit(a.ctx, "build:log", fmt.Sprintf("Error: build failed: %v", err))
 	}
+
+	if record != nil {
+		if err := a.history.FinishBuild(record.ID, err); err != nil {
+			log.Printf("Failed to record build result: %v", err)
+		}
+		status := history.StatusSucceeded
+		if err != nil {
+			status = history.StatusFailed
+		}
+		if err := a.repo.RecordBuild(absPath, record.ID, record.Commit, status, record.StartedAt); err != nil {
+			log.Printf("Failed to record build in repo index: %v", err)
+		}
+	}
+}
+
+// BuildRef builds a branch, tag or commit of a repository in its own
+// worktree, so several refs can build at once without touching the main
+// checkout. With a name the worktree is kept and reused by later builds.
+func (a *App) BuildRef(repoPath string, opts repo.WorktreeOptions, platform string) (*history.BuildRecord, error) {
+	if a.packBuilder == nil {
+		return nil, errDockerUnavailable
+	}
+	if platform != "arm64" && platform != "amd64" {
+		return nil, fmt.Errorf("invalid platform: %s", platform)
+	}
+	info, err := a.repo.RepoForPath(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := a.repo.CreateWorktree(info.Path, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := a.repo.ReleaseWorktree(w.Path); err != nil {
+			log.Printf("Failed to release worktree: %v", err)
+		}
+	}()
+
+	// Each ref gets its own image, and with it its own layer cache
+	image := strings.ToLower(info.Name) + ":" + imageTag(opts.Ref)
+	record, err := a.history.StartBuild(info.Path, image, platform, w.Commit)
+	if err != nil {
+		log.Printf("Failed to record build: %v", err)
+	}
+
+	err = a.packBuilder.BuildWithOptions(pack.BuildOptions{
+		Path:      w.Path,
+		Platform:  platform,
+		ImageName: image,
+	})
+	if err != nil {
+		runtime.EventsEmit(a.ctx, "build:log", fmt.Sprintf("Error: build of %s failed: %v", opts.Ref, err))
+	}
+
+	if record != nil {
+		if err := a.history.FinishBuild(record.ID, err); err != nil {
+			log.Printf("Failed to record build result: %v", err)
+		}
+		status := history.StatusSucceeded
+		if err != nil {
+			status = history.StatusFailed
+		}
+		if err := a.repo.RecordWorktreeBuild(w.Path, record.ID, status, record.StartedAt); err != nil {
+			log.Printf("Failed to record build in repo index: %v", err)
+		}
+		if latest, getErr := a.history.Get(record.ID); getErr == nil {
+			record = latest
+		}
+	}
+	return record, err
+}
+
+// CreateWorktree checks out a ref of a repository into its own worktree
+func (a *App) CreateWorktree(repoPath string, opts repo.WorktreeOptions) (*repo.Worktree, error) {
+	return a.repo.CreateWorktree(repoPath, opts)
+}
+
+// ListWorktrees returns the worktrees of a repository, or all if repoPath is empty
+func (a *App) ListWorktrees(repoPath string) []*repo.Worktree {
+	return a.repo.ListWorktrees(repoPath)
+}
+
+// RemoveWorktree deletes a worktree of a repository
+func (a *App) RemoveWorktree(repoPath, worktreePath string) error {
+	return a.repo.RemoveWorktree(repoPath, worktreePath)
+}
+
+// RunTests runs the repository's test suite inside the built image via Dagger
+// and records the result with the image's latest build
+func (a *App) RunTests(opts dagger.TestOptions) (*dagger.TestResult, error) {
+	if a.daggerRunner == nil {
+		return nil, errDaggerUnavailable
+	}
+	result, err := a.daggerRunner.RunTests(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if record, err := a.history.LatestForImage(opts.Image); err == nil {
+		if err := a.history.AddTestResult(record.ID, history.TestResult{
+			Command:    result.Command,
+			Passed:     result.Passed,
+			ExitCode:   result.ExitCode,
+			StartedAt:  result.StartedAt,
+			DurationMs: result.DurationMs,
+			Output:     result.Output,
+		}); err != nil {
+			log.Printf("Failed to record test result: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// GetPipelineConfig returns the pipeline defined in the repository's bskit.yaml
+func (a *App) GetPipelineConfig(repoPath string) (*pipeline.Config, error) {
+	return pipeline.LoadConfig(repoPath)
+}
+
+// RunPipeline executes the repository's bskit.yaml pipeline
+func (a *App) RunPipeline(repoPath string) (*pipeline.Execution, error) {
+	if a.pipelines == nil {
+		return nil, errDaggerUnavailable
+	}
+	return a.pipelines.Run(repoPath)
+}
+
+// ListPipelineExecutions returns the pipeline runs of a repository, most recent first
+func (a *App) ListPipelineExecutions(repoPath string) []*pipeline.Execution {
+	if a.pipelines == nil {
+		return []*pipeline.Execution{}
+	}
+	return a.pipelines.List(repoPath)
+}
+
+// GetBuildHistory returns the builds of a repository, most recent first
+func (a *App) GetBuildHistory(repoPath string) []*history.BuildRecord {
+	return a.history.List(repoPath)
 }
 
 // SelectDirectory opens a directory selection dialog and returns the selected path
@@ -171,9 +445,35 @@ func (a *App) CloneRepo(url string) (string, error) {
 	return a.repo.CloneRepo(url)
 }
 
-// GetRepoStatus checks if a repository is already cloned
-func (a *App) GetRepoStatus(url string) (*repo.RepoStatus, error) {
-	return a.repo.GetRepoStatus(url)
+// CloneRepoWithOptions clones a repository shallow, single-branch, at a ref or sparse
+func (a *App) CloneRepoWithOptions(opts repo.CloneOptions) (string, error) {
+	return a.repo.CloneRepoWithOptions(opts)
+}
+
+// DeepenRepo fetches more history for a shallow clone, all of it for depth 0
+func (a *App) DeepenRepo(repoPath string, depth int) error {
+	return a.repo.DeepenRepo(repoPath, depth)
+}
+
+// WidenRepo fetches all branches or grows the sparse checkout of a clone
+func (a *App) WidenRepo(repoPath string, opts repo.WidenOptions) error {
+	return a.repo.WidenRepo(repoPath, opts)
+}
+
+// CancelClone stops a clone in progress, given its URL or repo ID
+func (a *App) CancelClone(urlOrID string) error {
+	return a.repo.CancelClone(urlOrID)
+}
+
+// GetRepoStatus checks if a repository is already cloned, given its URL or
+// the ID or path of a registered repository
+func (a *App) GetRepoStatus(urlOrID string) (*repo.RepoStatus, error) {
+	return a.repo.GetRepoStatus(urlOrID)
+}
+
+// GetPathStatus returns the working tree status of the checkout at path
+func (a *App) GetPathStatus(path string) (*repo.RepoStatus, error) {
+	return a.repo.GetPathStatus(path)
 }
 
 // ListClonedRepos returns a list of all cloned repositories
@@ -181,6 +481,335 @@ func (a *App) ListClonedRepos() ([]string, error) {
 	return a.repo.ListClonedRepos()
 }
 
+// FetchRepo fetches the latest branches and tags of a cloned repository
+func (a *App) FetchRepo(repoPath string) error {
+	return a.repo.FetchRepo(repoPath)
+}
+
+// PullRepo fast-forwards the current branch of a cloned repository
+func (a *App) PullRepo(repoPath string) error {
+	return a.repo.PullRepo(repoPath)
+}
+
+// ListBranches returns the local and origin branches of a repository
+func (a *App) ListBranches(repoPath string) ([]repo.Branch, error) {
+	return a.repo.ListBranches(repoPath)
+}
+
+// ListTags returns the tags of a repository
+func (a *App) ListTags(repoPath string) ([]repo.Tag, error) {
+	return a.repo.ListTags(repoPath)
+}
+
+// CheckoutRef checks out a branch, tag or commit in a repository
+func (a *App) CheckoutRef(repoPath, ref string) error {
+	return a.repo.Checkout(repoPath, ref)
+}
+
+// GetRepoSettings returns the repository settings, such as the SSH key
+func (a *App) GetRepoSettings() repo.Settings {
+	return a.repo.GetSettings()
+}
+
+// SaveRepoSettings stores the repository settings
+func (a *App) SaveRepoSettings(settings repo.Settings) error {
+	return a.repo.SaveSettings(settings)
+}
+
+// SetSSHPassphrase unlocks the configured SSH key for this session
+func (a *App) SetSSHPassphrase(passphrase string) error {
+	return a.repo.SetSSHPassphrase(passphrase)
+}
+
+// GetWorkspaceInfo returns where repositories are stored and their disk usage
+func (a *App) GetWorkspaceInfo() (*repo.WorkspaceInfo, error) {
+	return a.repo.GetWorkspaceInfo()
+}
+
+// ImportLocalRepo registers an existing local checkout without copying it
+func (a *App) ImportLocalRepo(path string) (*repo.RepoInfo, error) {
+	return a.repo.ImportLocalRepo(path)
+}
+
+// ListRepos returns the registered repositories with their metadata
+func (a *App) ListRepos() []*repo.RepoInfo {
+	return a.repo.ListRepos()
+}
+
+// SetRepoTags replaces the tags of a registered repository
+func (a *App) SetRepoTags(repoID string, tags []string) error {
+	return a.repo.SetRepoTags(repoID, tags)
+}
+
+// RunImage starts a bskit-managed container, optionally selecting a buildpack
+// process type or overriding the command
+func (a *App) RunImage(opts run.Options) (*run.Run, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	r, err := a.runManager.Start(opts)
+	if err != nil {
+		return nil, err
+	}
+	go a.smoke.RunIfDefined(r.ID, "")
+	return r, nil
+}
+
+// ListProcessTypes returns the process types defined by the buildpacks of an image
+func (a *App) ListProcessTypes(imageName string) ([]run.ProcessType, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.runManager.ListProcessTypes(imageName)
+}
+
+// ListVolumes returns the named volumes bskit created for a repository. An
+// empty path lists the volumes of every repository.
+func (a *App) ListVolumes(repoPath string) ([]run.Volume, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.runManager.ListVolumes(repoPath)
+}
+
+// DeleteVolume removes a named volume created by bskit
+func (a *App) DeleteVolume(name string) error {
+	if a.runManager == nil {
+		return errDockerUnavailable
+	}
+	return a.runManager.DeleteVolume(name)
+}
+
+// ListRuns returns the containers currently managed by bskit
+func (a *App) ListRuns() []*run.Run {
+	if a.runManager == nil {
+		return []*run.Run{}
+	}
+	return a.runManager.List()
+}
+
+// StopRun stops a bskit-managed container
+func (a *App) StopRun(runID string) error {
+	if a.runManager == nil {
+		return errDockerUnavailable
+	}
+	return a.runManager.Stop(runID)
+}
+
+// ListEngineContainers returns the last known state of every bskit-managed container
+func (a *App) ListEngineContainers() []*engine.ContainerState {
+	if a.engine == nil {
+		return []*engine.ContainerState{}
+	}
+	return a.engine.ListContainers()
+}
+
+// ListEngineImages returns the buildpack and bskit images known to Docker
+func (a *App) ListEngineImages() []*engine.ImageState {
+	if a.engine == nil {
+		return []*engine.ImageState{}
+	}
+	return a.engine.ListImages()
+}
+
+// SnapshotRun commits a run's container to a new tagged image, optionally
+// exporting it to a tarball at exportPath
+func (a *App) SnapshotRun(runID, tag, exportPath string) (*run.Snapshot, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.runManager.SnapshotRun(runID, tag, exportPath)
+}
+
+// GetRunStats returns the recent CPU, memory, network and block IO samples of
+// a bskit-managed container. New samples are emitted as run:stats events.
+func (a *App) GetRunStats(runID string) ([]run.StatsSample, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.runManager.GetStats(runID)
+}
+
+// OpenShell opens an interactive shell in a bskit-managed container. Output is
+// emitted as exec:output events; input and resizes are sent as exec:input and
+// exec:resize events.
+func (a *App) OpenShell(runID string, cols, rows uint) (*run.ExecSession, error) {
+	if a.runManager == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.runManager.OpenShell(runID, cols, rows)
+}
+
+// CloseShell ends an interactive shell session
+func (a *App) CloseShell(sessionID string) error {
+	if a.runManager == nil {
+		return errDockerUnavailable
+	}
+	return a.runManager.CloseExec(sessionID)
+}
+
+// ListRoutes returns the friendly hostnames the proxy serves for running apps
+func (a *App) ListRoutes() []proxy.Route {
+	if a.proxy == nil {
+		return []proxy.Route{}
+	}
+	return a.proxy.ListRoutes()
+}
+
+// GetProxyStatus returns the proxy configuration and whether it is listening
+func (a *App) GetProxyStatus() proxy.Status {
+	if a.proxy == nil {
+		return proxy.Status{Error: "the proxy is not available"}
+	}
+	return a.proxy.GetStatus()
+}
+
+// ConfigureProxy restarts the proxy with a new configuration
+func (a *App) ConfigureProxy(config proxy.Config) error {
+	if a.proxy == nil {
+		return fmt.Errorf("the proxy is not available")
+	}
+	return a.proxy.Start(config)
+}
+
+// GetServices returns the companion services declared for a repository
+func (a *App) GetServices(repoPath string) ([]environment.ServiceSpec, error) {
+	return environment.LoadServices(repoPath)
+}
+
+// SaveServices stores the companion services declared for a repository
+func (a *App) SaveServices(repoPath string, services []environment.ServiceSpec) error {
+	return environment.SaveServices(repoPath, services)
+}
+
+// ImportComposeServices reads companion services from the repository's compose file
+func (a *App) ImportComposeServices(repoPath string) ([]environment.ServiceSpec, error) {
+	return environment.ImportCompose(repoPath)
+}
+
+// StartEnvironment starts the repository's companion services and then the app itself
+func (a *App) StartEnvironment(repoPath string, app run.Options) (*environment.Environment, error) {
+	if a.environments == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.environments.Start(repoPath, app)
+}
+
+// TeardownEnvironment stops every container of an environment and removes its network
+func (a *App) TeardownEnvironment(envID string) error {
+	if a.environments == nil {
+		return errDockerUnavailable
+	}
+	return a.environments.Teardown(envID)
+}
+
+// ListEnvironments returns the running environments
+func (a *App) ListEnvironments() []*environment.Environment {
+	if a.environments == nil {
+		return []*environment.Environment{}
+	}
+	return a.environments.List()
+}
+
+// StartWatch rebuilds a source directory whenever it changes, restarting the
+// associated run once the new image is ready
+func (a *App) StartWatch(opts watch.Options) (*watch.Watch, error) {
+	if a.watches == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.watches.Start(opts)
+}
+
+// StopWatch stops watching a source directory
+func (a *App) StopWatch(watchID string) error {
+	if a.watches == nil {
+		return errDockerUnavailable
+	}
+	return a.watches.Stop(watchID)
+}
+
+// ListWatches returns the active watches
+func (a *App) ListWatches() []*watch.Watch {
+	if a.watches == nil {
+		return []*watch.Watch{}
+	}
+	return a.watches.List()
+}
+
+// GetSmokeChecks returns the smoke checks declared for a repository
+func (a *App) GetSmokeChecks(repoPath string) ([]smoke.Check, error) {
+	return smoke.LoadChecks(repoPath)
+}
+
+// SaveSmokeChecks writes the smoke checks of a repository
+func (a *App) SaveSmokeChecks(repoPath string, checks []smoke.Check) error {
+	return smoke.SaveChecks(repoPath, checks)
+}
+
+// RunSmokeTests runs the smoke checks of a run's repository against it once it is healthy
+func (a *App) RunSmokeTests(runID string) (*smoke.Report, error) {
+	if a.smoke == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.smoke.Run(runID, "")
+}
+
+// StartLoadTest starts an HTTP load test against a run
+func (a *App) StartLoadTest(opts load.Options) (*load.Result, error) {
+	if a.load == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.load.Start(opts)
+}
+
+// StopLoadTest cancels a running load test
+func (a *App) StopLoadTest(testID string) error {
+	if a.load == nil {
+		return errDockerUnavailable
+	}
+	return a.load.Stop(testID)
+}
+
+// ListLoadTests returns the load tests of a run, or all load tests if runID is empty
+func (a *App) ListLoadTests(runID string) []*load.Result {
+	if a.load == nil {
+		return []*load.Result{}
+	}
+	return a.load.List(runID)
+}
+
+// CreatePreview checks out, builds and runs a branch or pull request as a named preview
+func (a *App) CreatePreview(opts preview.Options) (*preview.Preview, error) {
+	if a.previews == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.previews.Create(opts)
+}
+
+// RefreshPreview rebuilds a preview from the latest commit of its branch
+func (a *App) RefreshPreview(name string) (*preview.Preview, error) {
+	if a.previews == nil {
+		return nil, errDockerUnavailable
+	}
+	return a.previews.Refresh(name)
+}
+
+// TeardownPreview stops a preview and removes its worktree and image
+func (a *App) TeardownPreview(name string) error {
+	if a.previews == nil {
+		return errDockerUnavailable
+	}
+	return a.previews.Teardown(name)
+}
+
+// ListPreviews returns the previews of a repository, or all previews if repoPath is empty
+func (a *App) ListPreviews(repoPath string) []*preview.Preview {
+	if a.previews == nil {
+		return []*preview.Preview{}
+	}
+	return a.previews.List(repoPath)
+}
+
 // Add detailed logging to confirm the method is called and to log any errors
 // Add a log to confirm if DeleteRepo is being triggered from the frontend
 func (a *App) DeleteRepo(repoPath string) error {
@@ -194,7 +823,7 @@ func (a *App) DeleteRepo(repoPath string) error {
 	}
 
 	// Attempt to delete the repository
-	err := repo.DeleteRepo(repoPath)
+	err := a.repo.DeleteRepo(repoPath)
 	if err != nil {
 		fmt.Printf("Error deleting repository at path: %s, error: %v\n", repoPath, err) // Log the error
 		return fmt.Errorf("failed to delete repository at %s: %w", repoPath, err)
@@ -203,3 +832,37 @@ func (a *App) DeleteRepo(repoPath string) error {
 	fmt.Printf("Successfully deleted repository at path: %s\n", repoPath) // Log successful deletion
 	return nil
 }
+
+// imageTag turns a git ref into a valid image tag
+func imageTag(ref string) string {
+	tag := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		}
+		return '-'
+	}, strings.TrimPrefix(ref, "refs/"))
+	tag = strings.TrimLeft(tag, "-.")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	if tag == "" {
+		return "latest"
+	}
+	return tag
+}
+
+// stringSlice converts a list received from the frontend into a string slice
+func stringSlice(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var result []string
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
@@ -2,11 +2,16 @@ package auth
 
 import (
 	"context"
+	"strings"
+	"sync"
 )
 
 // Auth encapsulates the GitHub OAuth functionality.
 type Auth struct {
-	ctx         context.Context
+	ctx context.Context
+	// mu guards accessToken, which is set by the login flow in the
+	// background and read by git operations
+	mu          sync.RWMutex
 	accessToken *AccessToken
 }
 
@@ -17,9 +22,27 @@ func NewAuth(ctx context.Context) *Auth {
 
 // GetAccessToken returns the current access token if available
 func (a *Auth) GetAccessToken() *AccessToken {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
 	return a.accessToken
 }
 
+func (a *Auth) setAccessToken(token *AccessToken) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accessToken = token
+}
+
+// TokenForHost returns the access token and its scopes for a git host. Only
+// github.com is supported.
+func (a *Auth) TokenForHost(host string) (token, scopes string) {
+	accessToken := a.GetAccessToken()
+	if accessToken == nil || !strings.EqualFold(host, "github.com") {
+		return "", ""
+	}
+	return accessToken.Token, accessToken.Scope
+}
+
 // StartGitHubLogin starts the GitHub device flow authentication.
 // It returns the device code and verification URI, and starts polling for the token in the background.
 // The token will be emitted as an event when available.
@@ -58,7 +58,7 @@ func (a *Auth) StartDeviceAuth() (*UserCodeInfo, error) {
 		}
 
 		// Store the token in memory
-		a.accessToken = accessToken
+		a.setAccessToken(accessToken)
 
 		// Fetch user info
 		userInfo, err := a.fetchUserInfo(token.Token)
@@ -165,6 +165,7 @@ func GetUserCodeInfo() (*UserCodeInfo, error) {
 	code, err := device.RequestCode(httpClient, "https://github.com/login/device/code", githubClientID, []string{
 		"read:user",  // For basic profile info
 		"user:email", // For email access
+		"repo",       // For cloning and fetching private repositories
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to request device code: %w", err)
@@ -209,7 +210,8 @@ func pollForToken(ctx context.Context, httpClient *http.Client, userCodeInfo *Us
 
 // GetRecentRepos fetches the user's recent repositories using GraphQL
 func (a *Auth) GetRecentRepos() ([]Repo, error) {
-	if a.accessToken == nil {
+	accessToken := a.GetAccessToken()
+	if accessToken == nil {
 		return nil, fmt.Errorf("not authenticated")
 	}
 
@@ -262,7 +264,7 @@ func (a *Auth) GetRecentRepos() ([]Repo, error) {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.accessToken.Token))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken.Token))
 	req.Header.Set("Content-Type", "application/json")
 
 	log.Printf("Making request to GitHub GraphQL API with headers: %v", req.Header)
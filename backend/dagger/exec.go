@@ -0,0 +1,166 @@
+package dagger
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// AppDir is where buildpacks put the built app in the image
+const AppDir = "/workspace"
+
+// ExecOptions describes a command run in a container through Dagger
+type ExecOptions struct {
+	// Image is pulled from a registry
+	Image string `json:"image"`
+	// LocalImage is loaded from the local docker daemon instead, e.g. a pack build
+	LocalImage string `json:"localImage"`
+	// SourcePath is mounted at /workspace, which becomes the working
+	// directory. Leave it empty for built images, where it would hide the
+	// built app.
+	SourcePath string `json:"sourcePath"`
+	// Workdir overrides the working directory
+	Workdir string   `json:"workdir"`
+	Command []string `json:"command"`
+	// UseLauncher runs the command through the CNB launcher so buildpack
+	// layers are on PATH
+	UseLauncher bool              `json:"useLauncher"`
+	Env         map[string]string `json:"env"`
+	// Caches maps mount paths to cache volume names that persist between runs
+	Caches map[string]string `json:"caches"`
+	// DockerSocket mounts the host docker socket into the container
+	DockerSocket bool `json:"dockerSocket"`
+	// NoCache forces the command to run even if Dagger has a cached result
+	NoCache bool `json:"noCache"`
+	// Output receives the lines the command wrote to stdout and stderr once
+	// it has finished. Dagger only streams the log of the whole session,
+	// which would mix in the output of commands running at the same time.
+	Output func(line string) `json:"-"`
+}
+
+// ExecResult is the outcome of a command run through Dagger
+type ExecResult struct {
+	ExitCode   int       `json:"exitCode"`
+	Stdout     string    `json:"stdout"`
+	Stderr     string    `json:"stderr"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Exec runs a command in a container and waits for it to finish. A non-zero
+// exit code is reported in the result rather than as an error.
+func (r *Runner) Exec(opts ExecOptions) (*ExecResult, error) {
+	if len(opts.Command) == 0 {
+		return nil, fmt.Errorf("no command specified")
+	}
+
+	var ctr *dagger.Container
+	switch {
+	case opts.LocalImage != "":
+		ctr = r.importImage(opts.LocalImage)
+	case opts.Image != "":
+		ctr = r.client.Container().From(opts.Image)
+	default:
+		return nil, fmt.Errorf("no image specified")
+	}
+
+	if opts.SourcePath != "" {
+		if _, err := os.Stat(opts.SourcePath); err != nil {
+			return nil, fmt.Errorf("invalid source path: %w", err)
+		}
+		source := r.client.Host().Directory(opts.SourcePath, dagger.HostDirectoryOpts{
+			Exclude: []string{".git"},
+		})
+		ctr = ctr.
+			WithMountedDirectory("/workspace", source).
+			WithWorkdir("/workspace")
+	}
+	if opts.Workdir != "" {
+		ctr = ctr.WithWorkdir(opts.Workdir)
+	}
+
+	if opts.DockerSocket {
+		ctr = ctr.WithUnixSocket("/var/run/docker.sock", r.client.Host().UnixSocket("/var/run/docker.sock"))
+	}
+
+	for _, path := range sortedKeys(opts.Caches) {
+		ctr = ctr.WithMountedCache(path, r.client.CacheVolume(opts.Caches[path]))
+	}
+
+	for _, k := range sortedKeys(opts.Env) {
+		ctr = ctr.WithEnvVariable(k, opts.Env[k])
+	}
+	if opts.NoCache {
+		ctr = ctr.WithEnvVariable("BSKIT_CACHE_BUSTER", time.Now().Format(time.RFC3339Nano))
+	}
+
+	args := opts.Command
+	if opts.UseLauncher {
+		args = append([]string{"/cnb/lifecycle/launcher"}, args...)
+	}
+	ctr = ctr.WithExec(args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+
+	r.streamLogs()
+
+	start := time.Now()
+	exitCode, err := ctr.ExitCode(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %v: %w", opts.Command, err)
+	}
+	duration := time.Since(start)
+
+	stdout, err := ctr.Stdout(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output: %w", err)
+	}
+	stderr, err := ctr.Stderr(r.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output: %w", err)
+	}
+
+	if opts.Output != nil {
+		emitLines(stdout, opts.Output)
+		emitLines(stderr, opts.Output)
+	}
+
+	return &ExecResult{
+		ExitCode:   exitCode,
+		Stdout:     stdout,
+		Stderr:     stderr,
+		StartedAt:  start,
+		DurationMs: duration.Milliseconds(),
+	}, nil
+}
+
+// Publish pushes a local image to a registry, using the registry credentials
+// of the host, and returns the published reference
+func (r *Runner) Publish(localImage, address string) (string, error) {
+	ref, err := r.importImage(localImage).Publish(r.ctx, address)
+	if err != nil {
+		return "", fmt.Errorf("failed to publish %s: %w", address, err)
+	}
+	return ref, nil
+}
+
+// emitLines calls fn with every non-empty line of output
+func emitLines(output string, fn func(line string)) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line != "" {
+			fn(line)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,31 @@
+package dagger
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEmitLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{name: "empty", output: "", want: nil},
+		{name: "trailing newline", output: "ok\tpkg\n", want: []string{"ok\tpkg"}},
+		{name: "no trailing newline", output: "a\nb", want: []string{"a", "b"}},
+		{name: "blank lines", output: "a\n\n\nb\n", want: []string{"a", "b"}},
+		{name: "carriage returns", output: "a\r\nb\r\n", want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			emitLines(tt.output, func(line string) {
+				got = append(got, line)
+			})
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
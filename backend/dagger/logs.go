@@ -0,0 +1,41 @@
+package dagger
+
+import (
+	"bytes"
+	"sync"
+)
+
+// logOutput receives Dagger's log output and buffers it for the build:log
+// forwarder
+type logOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	// written is signalled when output is buffered, so the forwarder doesn't poll
+	written chan struct{}
+}
+
+func newLogOutput() *logOutput {
+	return &logOutput{written: make(chan struct{}, 1)}
+}
+
+func (l *logOutput) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf.Write(p)
+	select {
+	case l.written <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// drain returns and clears the buffered output
+func (l *logOutput) drain() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := l.buf.String()
+	l.buf.Reset()
+	return out
+}
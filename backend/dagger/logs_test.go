@@ -0,0 +1,30 @@
+package dagger
+
+import "testing"
+
+func TestLogOutputSignalsWrites(t *testing.T) {
+	l := newLogOutput()
+
+	select {
+	case <-l.written:
+		t.Fatal("signalled before anything was written")
+	default:
+	}
+
+	// Several writes coalesce into one signal and one drain
+	l.Write([]byte("one\n"))
+	l.Write([]byte("two\n"))
+	select {
+	case <-l.written:
+	default:
+		t.Fatal("expected a signal after writing")
+	}
+	if out := l.drain(); out != "one\ntwo\n" {
+		t.Errorf("drained %q", out)
+	}
+	select {
+	case <-l.written:
+		t.Fatal("expected a single signal for both writes")
+	default:
+	}
+}
@@ -1,25 +1,26 @@
 package dagger
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"sync"
 
 	"dagger.io/dagger"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type Runner struct {
-	client *dagger.Client
-	ctx    context.Context
-	logBuf *bytes.Buffer
+	client  *dagger.Client
+	ctx     context.Context
+	logs    *logOutput
+	logOnce sync.Once
 }
 
 func NewRunner(ctx context.Context) (*Runner, error) {
-	logBuf := &bytes.Buffer{}
+	logs := newLogOutput()
 
 	client, err := dagger.Connect(ctx,
-		dagger.WithLogOutput(logBuf),
+		dagger.WithLogOutput(logs),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to dagger: %w", err)
@@ -28,11 +29,12 @@ func NewRunner(ctx context.Context) (*Runner, error) {
 	return &Runner{
 		client: client,
 		ctx:    ctx,
-		logBuf: logBuf,
+		logs:   logs,
 	}, nil
 }
 
-func (r *Runner) RunContainer(imageName string) error {
+// importImage loads an image from the local docker daemon into Dagger
+func (r *Runner) importImage(imageName string) *dagger.Container {
 	// 1) Prep the host socket
 	socket := r.client.Host().UnixSocket("/var/run/docker.sock")
 
@@ -47,33 +49,30 @@ func (r *Runner) RunContainer(imageName string) error {
 		File("/tmp/image.tar")
 
 	// 3) Import that tarball as a real Container in Dagger
-	ctr := r.client.
+	return r.client.
 		Container().
-		Import(tarFile).
-		WithExposedPort(3000)
-
-	// 4) Kick it off (Sync or Stdout will block until exit, but logs stream via WithLogOutput)
-	if _, err := ctr.Sync(r.ctx); err != nil {
-		return fmt.Errorf("failed to start container: %w", err)
-	}
+		Import(tarFile)
+}
 
-	// 5) Meanwhile your dagger.Connect was set up with WithLogOutput(&r.logBuf),
-	//    so all `docker run` output is flowing into r.logBuf in real time.
-	go func() {
-		for {
-			select {
-			case <-r.ctx.Done():
-				return
-			default:
-				if r.logBuf.Len() > 0 {
-					runtime.EventsEmit(r.ctx, "build:log", r.logBuf.String())
-					r.logBuf.Reset()
+// streamLogs forwards the Dagger log output to the frontend. Our dagger.Connect
+// was set up with WithLogOutput(r.logs), so all container output flows into
+// r.logs in real time. The forwarder is only started once per runner and
+// sleeps until new output is written.
+func (r *Runner) streamLogs() {
+	r.logOnce.Do(func() {
+		go func() {
+			for {
+				select {
+				case <-r.ctx.Done():
+					return
+				case <-r.logs.written:
+					if out := r.logs.drain(); out != "" {
+						runtime.EventsEmit(r.ctx, "build:log", out)
+					}
 				}
 			}
-		}
-	}()
-
-	return nil
+		}()
+	})
 }
 
 func (r *Runner) Close() error {
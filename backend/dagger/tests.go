@@ -0,0 +1,175 @@
+package dagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// defaultBuilder is the builder image used by pack builds
+const defaultBuilder = "paketobuildpacks/builder-jammy-base"
+
+// maxTestOutput bounds how much test output is kept in the result
+const maxTestOutput = 64 * 1024
+
+// TestOptions configures a test run
+type TestOptions struct {
+	// Image is the built image the tests run in
+	Image string `json:"image"`
+	// SourcePath is where the test command is detected. It is only mounted
+	// when testing in the builder image; the built image already holds the
+	// built app, with its installed dependencies, in its app directory.
+	SourcePath string `json:"sourcePath"`
+	// Command overrides the auto-detected test command
+	Command []string `json:"command"`
+	// UseBuilder runs the tests in the builder image instead of the built image
+	UseBuilder bool `json:"useBuilder"`
+	// BuilderImage overrides the default builder image
+	BuilderImage string `json:"builderImage"`
+	// Caches maps mount paths to cache volume names, e.g. for dependency caches
+	Caches map[string]string `json:"caches"`
+	// Env is set in the test container in addition to CI=true
+	Env map[string]string `json:"env"`
+	// Output receives the lines of test output once the tests have run
+	Output func(line string) `json:"-"`
+}
+
+// TestResult is the outcome of a test run
+type TestResult struct {
+	Image      string    `json:"image"`
+	Command    []string  `json:"command"`
+	Passed     bool      `json:"passed"`
+	ExitCode   int       `json:"exitCode"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Output     string    `json:"output"`
+}
+
+// RunTests executes the test suite of a repo in the app directory of the
+// built image, or in the builder image with the source mounted
+func (r *Runner) RunTests(opts TestOptions) (*TestResult, error) {
+	if opts.Image == "" && !opts.UseBuilder {
+		return nil, fmt.Errorf("no image specified")
+	}
+
+	command := opts.Command
+	if len(command) == 0 {
+		command = DetectTestCommand(opts.SourcePath)
+		if len(command) == 0 {
+			return nil, fmt.Errorf("could not detect a test command, please configure one")
+		}
+	}
+
+	env := map[string]string{"CI": "true"}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+
+	execOpts := ExecOptions{
+		Command: command,
+		Env:     env,
+		Caches:  opts.Caches,
+		Output:  opts.Output,
+		// Bust the cache so the suite really runs every time
+		NoCache: true,
+	}
+	if opts.UseBuilder {
+		execOpts.Image = opts.BuilderImage
+		if execOpts.Image == "" {
+			execOpts.Image = defaultBuilder
+		}
+		execOpts.SourcePath = opts.SourcePath
+	} else {
+		execOpts.LocalImage = opts.Image
+		execOpts.UseLauncher = true
+		execOpts.Workdir = AppDir
+	}
+
+	runtime.EventsEmit(r.ctx, "build:log", fmt.Sprintf("\n\x1b[1;34m$ %s\x1b[0m", strings.Join(command, " ")))
+
+	res, err := r.Exec(execOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run tests: %w", err)
+	}
+
+	output := res.Stdout + res.Stderr
+	if len(output) > maxTestOutput {
+		output = output[len(output)-maxTestOutput:]
+	}
+
+	result := &TestResult{
+		Image:      opts.Image,
+		Command:    command,
+		Passed:     res.ExitCode == 0,
+		ExitCode:   res.ExitCode,
+		StartedAt:  res.StartedAt,
+		DurationMs: res.DurationMs,
+		Output:     output,
+	}
+
+	if result.Passed {
+		runtime.EventsEmit(r.ctx, "build:log", fmt.Sprintf("\n\x1b[1;32m✓ Tests passed in %s\x1b[0m", time.Duration(res.DurationMs)*time.Millisecond))
+	} else {
+		runtime.EventsEmit(r.ctx, "build:log", fmt.Sprintf("\n\x1b[1;31m✗ Tests failed with exit code %d\x1b[0m", res.ExitCode))
+	}
+	runtime.EventsEmit(r.ctx, "test:result", result)
+
+	return result, nil
+}
+
+// DetectTestCommand guesses the test command of a repo from the files at its root
+func DetectTestCommand(sourcePath string) []string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(sourcePath, name))
+		return err == nil
+	}
+
+	// A package.json without a test script may sit next to another project,
+	// e.g. frontend tooling in a Go repo, so keep looking
+	if exists("package.json") && hasNpmTestScript(filepath.Join(sourcePath, "package.json")) {
+		if exists("yarn.lock") {
+			return []string{"yarn", "test"}
+		}
+		return []string{"npm", "test"}
+	}
+
+	switch {
+	case exists("go.mod"):
+		return []string{"go", "test", "./..."}
+	case exists("mvnw"):
+		return []string{"./mvnw", "-B", "test"}
+	case exists("pom.xml"):
+		return []string{"mvn", "-B", "test"}
+	case exists("gradlew"):
+		return []string{"./gradlew", "test"}
+	case exists("Cargo.toml"):
+		return []string{"cargo", "test"}
+	case exists("Gemfile"):
+		return []string{"bundle", "exec", "rake", "test"}
+	case exists("pyproject.toml"), exists("requirements.txt"), exists("setup.py"):
+		return []string{"python", "-m", "pytest"}
+	case exists("composer.json"):
+		return []string{"composer", "test"}
+	}
+	return nil
+}
+
+func hasNpmTestScript(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return false
+	}
+	return pkg.Scripts["test"] != ""
+}
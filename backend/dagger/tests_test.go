@@ -0,0 +1,69 @@
+package dagger
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetectTestCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name:  "npm",
+			files: map[string]string{"package.json": `{"scripts": {"test": "jest"}}`},
+			want:  []string{"npm", "test"},
+		},
+		{
+			name:  "yarn",
+			files: map[string]string{"package.json": `{"scripts": {"test": "jest"}}`, "yarn.lock": ""},
+			want:  []string{"yarn", "test"},
+		},
+		{
+			name:  "package.json without test script next to go.mod",
+			files: map[string]string{"package.json": `{"scripts": {"build": "vite build"}}`, "go.mod": "module x"},
+			want:  []string{"go", "test", "./..."},
+		},
+		{
+			name:  "invalid package.json next to Cargo.toml",
+			files: map[string]string{"package.json": `{`, "Cargo.toml": ""},
+			want:  []string{"cargo", "test"},
+		},
+		{
+			name:  "maven wrapper before pom.xml",
+			files: map[string]string{"mvnw": "", "pom.xml": ""},
+			want:  []string{"./mvnw", "-B", "test"},
+		},
+		{
+			name:  "python",
+			files: map[string]string{"requirements.txt": ""},
+			want:  []string{"python", "-m", "pytest"},
+		},
+		{
+			name:  "package.json without test script only",
+			files: map[string]string{"package.json": `{}`},
+			want:  nil,
+		},
+		{
+			name: "nothing to detect",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := DetectTestCommand(dir); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bskit/backend/run"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// buildpackLabel is present on every image built by buildpacks, which is how
+// we recognise images bskit built
+const buildpackLabel = "io.buildpacks.lifecycle.metadata"
+
+// Backoff bounds for resubscribing after the event stream drops
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Event types
+const (
+	TypeContainer = "container"
+	TypeImage     = "image"
+	TypeEngine    = "engine"
+)
+
+// Container states
+const (
+	StateCreated = "created"
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateExited  = "exited"
+	StateRemoved = "removed"
+)
+
+type EngineWatcher struct {
+	ctx          context.Context
+	dockerClient *client.Client
+	mu           sync.RWMutex
+	containers   map[string]*ContainerState
+	images       map[string]*ImageState
+	connected    bool
+	cancel       context.CancelFunc
+}
+
+// ContainerState is the last known state of a bskit-managed container
+type ContainerState struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	RunID    string `json:"runId"`
+	Repo     string `json:"repo"`
+	State    string `json:"state"`
+	Health   string `json:"health,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	// OOMKilled is set when the container was killed for running out of memory
+	OOMKilled bool      `json:"oomKilled"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ImageState is a buildpack or bskit image known to the engine
+type ImageState struct {
+	ID        string    `json:"id"`
+	Tags      []string  `json:"tags"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Event is a normalized docker event, emitted as an engine:event
+type Event struct {
+	Type string `json:"type"`
+	// Action is the docker action, e.g. start, die, destroy, tag or delete,
+	// or connected/disconnected for the engine itself
+	Action    string          `json:"action"`
+	ID        string          `json:"id,omitempty"`
+	Container *ContainerState `json:"container,omitempty"`
+	Image     *ImageState     `json:"image,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Time      time.Time       `json:"time"`
+}
+
+func NewEngineWatcher(ctx context.Context, dockerClient *client.Client) *EngineWatcher {
+	return &EngineWatcher{
+		ctx:          ctx,
+		dockerClient: dockerClient,
+		containers:   make(map[string]*ContainerState),
+		images:       make(map[string]*ImageState),
+	}
+}
+
+// Start subscribes to the docker event stream in the background, resubscribing
+// with backoff whenever the daemon goes away
+func (w *EngineWatcher) Start() {
+	ctx, cancel := context.WithCancel(w.ctx)
+
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.mu.Unlock()
+		cancel()
+		return
+	}
+	w.cancel = cancel
+	w.mu.Unlock()
+
+	go w.loop(ctx)
+}
+
+// Stop ends the subscription
+func (w *EngineWatcher) Stop() {
+	w.mu.Lock()
+	cancel := w.cancel
+	w.cancel = nil
+	w.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Connected reports whether the event stream is currently up
+func (w *EngineWatcher) Connected() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.connected
+}
+
+// ListContainers returns the known bskit-managed containers, including stopped ones
+func (w *EngineWatcher) ListContainers() []*ContainerState {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	containers := make([]*ContainerState, 0, len(w.containers))
+	for _, c := range w.containers {
+		copied := *c
+		containers = append(containers, &copied)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].UpdatedAt.After(containers[j].UpdatedAt)
+	})
+	return containers
+}
+
+// ListImages returns the known buildpack and bskit images
+func (w *EngineWatcher) ListImages() []*ImageState {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	images := make([]*ImageState, 0, len(w.images))
+	for _, img := range w.images {
+		copied := *img
+		copied.Tags = append([]string(nil), img.Tags...)
+		images = append(images, &copied)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].UpdatedAt.After(images[j].UpdatedAt)
+	})
+	return images
+}
+
+// loop keeps the subscription alive. Every (re)connect subscribes first and
+// then does a full resync, so nothing that changed while disconnected, or
+// between the two, is missed.
+func (w *EngineWatcher) loop(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		streamCtx, cancel := context.WithCancel(ctx)
+		messages, errs := w.subscribe(streamCtx)
+		err := w.sync()
+		if err == nil {
+			backoff = minBackoff
+			w.setConnected(true, nil)
+			err = w.consume(ctx, messages, errs)
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.setConnected(false, err)
+		log.Printf("Docker event stream lost, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// subscribe opens the container and image event stream
+func (w *EngineWatcher) subscribe(ctx context.Context) (<-chan events.Message, <-chan error) {
+	args := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("type", string(events.ImageEventType)),
+	)
+	return w.dockerClient.Events(ctx, events.ListOptions{Filters: args})
+}
+
+// consume handles events until the stream fails
+func (w *EngineWatcher) consume(ctx context.Context, messages <-chan events.Message, errs <-chan error) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			if err == nil {
+				err = fmt.Errorf("event stream closed")
+			}
+			return err
+		case msg := <-messages:
+			switch msg.Type {
+			case events.ContainerEventType:
+				w.handleContainer(msg)
+			case events.ImageEventType:
+				w.handleImage(msg)
+			}
+		}
+	}
+}
+
+// sync rebuilds the state from the daemon and emits the differences
+func (w *EngineWatcher) sync() error {
+	containers, err := w.dockerClient.ContainerList(w.ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", run.LabelManaged+"=true")),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %w", err)
+	}
+	images, err := w.dockerClient.ImageList(w.ctx, image.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+
+	now := time.Now()
+	nextContainers := make(map[string]*ContainerState, len(containers))
+	for _, c := range containers {
+		state := &ContainerState{
+			ID:        c.ID,
+			Image:     c.Image,
+			RunID:     c.Labels[run.LabelRunID],
+			Repo:      c.Labels[run.LabelRepo],
+			State:     normalizeState(c.State),
+			UpdatedAt: now,
+		}
+		if len(c.Names) > 0 {
+			state.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		nextContainers[c.ID] = state
+	}
+
+	nextImages := make(map[string]*ImageState)
+	for _, img := range images {
+		if !isTrackedImage(img.Labels) {
+			continue
+		}
+		nextImages[img.ID] = &ImageState{
+			ID:        img.ID,
+			Tags:      img.RepoTags,
+			Size:      img.Size,
+			UpdatedAt: now,
+		}
+	}
+
+	for _, e := range w.replace(nextContainers, nextImages, now) {
+		runtime.EventsEmit(w.ctx, "engine:event", e)
+	}
+	return nil
+}
+
+// replace swaps in the state read from the daemon and returns the events
+// describing what changed
+func (w *EngineWatcher) replace(nextContainers map[string]*ContainerState, nextImages map[string]*ImageState, now time.Time) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var changes []Event
+	for id, c := range nextContainers {
+		if old, ok := w.containers[id]; !ok || old.State != c.State {
+			copied := *c
+			changes = append(changes, Event{Type: TypeContainer, Action: "sync", ID: id, Container: &copied, Time: now})
+		}
+	}
+	for id, c := range w.containers {
+		if _, ok := nextContainers[id]; !ok {
+			copied := *c
+			copied.State = StateRemoved
+			changes = append(changes, Event{Type: TypeContainer, Action: string(events.ActionDestroy), ID: id, Container: &copied, Time: now})
+		}
+	}
+	for id, img := range nextImages {
+		if old, ok := w.images[id]; !ok || !slices.Equal(old.Tags, img.Tags) {
+			copied := *img
+			copied.Tags = append([]string(nil), img.Tags...)
+			changes = append(changes, Event{Type: TypeImage, Action: "sync", ID: id, Image: &copied, Time: now})
+		}
+	}
+	for id := range w.images {
+		if _, ok := nextImages[id]; !ok {
+			changes = append(changes, Event{Type: TypeImage, Action: string(events.ActionDelete), ID: id, Time: now})
+		}
+	}
+	w.containers = nextContainers
+	w.images = nextImages
+	return changes
+}
+
+func (w *EngineWatcher) handleContainer(msg events.Message) {
+	if event, ok := w.applyContainerEvent(msg); ok {
+		runtime.EventsEmit(w.ctx, "engine:event", event)
+	}
+}
+
+// applyContainerEvent updates the state of a container from a docker event
+// and returns the event to emit, if the event changed anything
+func (w *EngineWatcher) applyContainerEvent(msg events.Message) (Event, bool) {
+	attrs := msg.Actor.Attributes
+	if attrs[run.LabelManaged] != "true" {
+		return Event{}, false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state, ok := w.containers[msg.Actor.ID]
+	if !ok {
+		state = &ContainerState{
+			ID:    msg.Actor.ID,
+			Name:  attrs["name"],
+			Image: attrs["image"],
+			RunID: attrs[run.LabelRunID],
+			Repo:  attrs[run.LabelRepo],
+			State: StateCreated,
+		}
+		w.containers[msg.Actor.ID] = state
+	}
+
+	action := string(msg.Action)
+	switch {
+	case msg.Action == events.ActionStart, msg.Action == events.ActionRestart, msg.Action == events.ActionUnPause:
+		state.State = StateRunning
+		state.OOMKilled = false
+	case msg.Action == events.ActionPause:
+		state.State = StatePaused
+	case msg.Action == events.ActionDie:
+		state.State = StateExited
+		if code, err := strconv.Atoi(attrs["exitCode"]); err == nil {
+			state.ExitCode = code
+		}
+	case msg.Action == events.ActionOOM:
+		state.OOMKilled = true
+	case msg.Action == events.ActionDestroy:
+		state.State = StateRemoved
+		delete(w.containers, msg.Actor.ID)
+	case strings.HasPrefix(action, string(events.ActionHealthStatus)):
+		state.Health = strings.TrimSpace(strings.TrimPrefix(action, string(events.ActionHealthStatus)+":"))
+		action = string(events.ActionHealthStatus)
+	case msg.Action == events.ActionRename:
+		state.Name = strings.TrimPrefix(attrs["name"], "/")
+	case msg.Action == events.ActionCreate:
+	default:
+		// exec, attach, resize and friends don't change the state
+		return Event{}, false
+	}
+	state.UpdatedAt = eventTime(msg)
+	copied := *state
+
+	return Event{
+		Type:      TypeContainer,
+		Action:    action,
+		ID:        msg.Actor.ID,
+		Container: &copied,
+		Time:      copied.UpdatedAt,
+	}, true
+}
+
+func (w *EngineWatcher) handleImage(msg events.Message) {
+	id := msg.Actor.ID
+	switch msg.Action {
+	case events.ActionDelete:
+		w.mu.Lock()
+		_, ok := w.images[id]
+		delete(w.images, id)
+		w.mu.Unlock()
+		if ok {
+			runtime.EventsEmit(w.ctx, "engine:event", Event{
+				Type:   TypeImage,
+				Action: string(msg.Action),
+				ID:     id,
+				Time:   eventTime(msg),
+			})
+		}
+		return
+
+	case events.ActionTag, events.ActionUnTag, events.ActionPull, events.ActionLoad, events.ActionImport:
+	default:
+		return
+	}
+
+	// Tags and labels are read back from the image, since untag events carry neither
+	info, err := w.dockerClient.ImageInspect(w.ctx, id)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return
+		}
+		log.Printf("Failed to inspect image %s: %v", id, err)
+		return
+	}
+	var labels map[string]string
+	if info.Config != nil {
+		labels = info.Config.Labels
+	}
+	if !isTrackedImage(labels) {
+		return
+	}
+
+	state := &ImageState{
+		ID:        info.ID,
+		Tags:      info.RepoTags,
+		Size:      info.Size,
+		UpdatedAt: eventTime(msg),
+	}
+	w.mu.Lock()
+	w.images[info.ID] = state
+	w.mu.Unlock()
+
+	copied := *state
+	runtime.EventsEmit(w.ctx, "engine:event", Event{
+		Type:   TypeImage,
+		Action: string(msg.Action),
+		ID:     info.ID,
+		Image:  &copied,
+		Time:   copied.UpdatedAt,
+	})
+}
+
+func (w *EngineWatcher) setConnected(connected bool, err error) {
+	w.mu.Lock()
+	changed := w.connected != connected
+	w.connected = connected
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	event := Event{Type: TypeEngine, Action: "connected", Time: time.Now()}
+	if !connected {
+		event.Action = "disconnected"
+		if err != nil {
+			event.Error = err.Error()
+		}
+	}
+	runtime.EventsEmit(w.ctx, "engine:event", event)
+}
+
+// isTrackedImage reports whether an image was built by buildpacks or created by bskit
+func isTrackedImage(labels map[string]string) bool {
+	_, buildpack := labels[buildpackLabel]
+	return buildpack || labels[run.LabelManaged] == "true"
+}
+
+// normalizeState maps docker container states onto ours
+func normalizeState(state string) string {
+	switch state {
+	case "running", "restarting":
+		return StateRunning
+	case "paused":
+		return StatePaused
+	case "created":
+		return StateCreated
+	case "removing":
+		return StateRemoved
+	}
+	return StateExited
+}
+
+func eventTime(msg events.Message) time.Time {
+	if msg.TimeNano > 0 {
+		return time.Unix(0, msg.TimeNano)
+	}
+	return time.Now()
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"bskit/backend/run"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func containerEvent(id string, action events.Action, attrs map[string]string) events.Message {
+	managed := map[string]string{run.LabelManaged: "true", run.LabelRunID: "run-1", "name": "api", "image": "acme/api"}
+	for k, v := range attrs {
+		managed[k] = v
+	}
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: id, Attributes: managed},
+		TimeNano: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixNano(),
+	}
+}
+
+func TestApplyContainerEvent(t *testing.T) {
+	w := NewEngineWatcher(context.Background(), nil)
+
+	steps := []struct {
+		msg        events.Message
+		wantEmit   bool
+		wantAction string
+		wantState  string
+		check      func(t *testing.T, c *ContainerState)
+	}{
+		{msg: containerEvent("c1", events.ActionCreate, nil), wantEmit: true, wantAction: "create", wantState: StateCreated},
+		{msg: containerEvent("c1", events.ActionStart, nil), wantEmit: true, wantAction: "start", wantState: StateRunning},
+		{msg: containerEvent("c1", events.ActionExecStart, nil), wantState: StateRunning},
+		{
+			msg: containerEvent("c1", events.ActionHealthStatusHealthy, nil), wantEmit: true, wantAction: "health_status", wantState: StateRunning,
+			check: func(t *testing.T, c *ContainerState) {
+				if c.Health != "healthy" {
+					t.Errorf("got health %q, want healthy", c.Health)
+				}
+			},
+		},
+		{msg: containerEvent("c1", events.ActionPause, nil), wantEmit: true, wantAction: "pause", wantState: StatePaused},
+		{msg: containerEvent("c1", events.ActionUnPause, nil), wantEmit: true, wantAction: "unpause", wantState: StateRunning},
+		{msg: containerEvent("c1", events.ActionOOM, nil), wantEmit: true, wantAction: "oom", wantState: StateRunning},
+		{
+			msg: containerEvent("c1", events.ActionDie, map[string]string{"exitCode": "137"}), wantEmit: true, wantAction: "die", wantState: StateExited,
+			check: func(t *testing.T, c *ContainerState) {
+				if c.ExitCode != 137 || !c.OOMKilled {
+					t.Errorf("got exit code %d, OOM killed %v, want 137 and true", c.ExitCode, c.OOMKilled)
+				}
+			},
+		},
+		{
+			msg: containerEvent("c1", events.ActionRename, map[string]string{"name": "/api-old"}), wantEmit: true, wantAction: "rename", wantState: StateExited,
+			check: func(t *testing.T, c *ContainerState) {
+				if c.Name != "api-old" {
+					t.Errorf("got name %q, want api-old", c.Name)
+				}
+			},
+		},
+		{msg: containerEvent("c1", events.ActionDestroy, nil), wantEmit: true, wantAction: "destroy", wantState: StateRemoved},
+	}
+	for _, step := range steps {
+		event, ok := w.applyContainerEvent(step.msg)
+		if ok != step.wantEmit {
+			t.Fatalf("%s: got emit %v, want %v", step.msg.Action, ok, step.wantEmit)
+		}
+		if !ok {
+			continue
+		}
+		if event.Type != TypeContainer || event.Action != step.wantAction || event.ID != "c1" {
+			t.Errorf("%s: unexpected event %+v", step.msg.Action, event)
+		}
+		if event.Container.State != step.wantState {
+			t.Errorf("%s: got state %s, want %s", step.msg.Action, event.Container.State, step.wantState)
+		}
+		if event.Container.RunID != "run-1" || event.Time != eventTime(step.msg) {
+			t.Errorf("%s: unexpected container %+v", step.msg.Action, event.Container)
+		}
+		if step.check != nil {
+			step.check(t, event.Container)
+		}
+	}
+	if len(w.ListContainers()) != 0 {
+		t.Error("destroyed container is still listed")
+	}
+
+	unmanaged := containerEvent("c2", events.ActionStart, map[string]string{run.LabelManaged: ""})
+	if _, ok := w.applyContainerEvent(unmanaged); ok || len(w.ListContainers()) != 0 {
+		t.Error("expected containers without the managed label to be ignored")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	w := NewEngineWatcher(context.Background(), nil)
+	now := time.Now()
+
+	changes := w.replace(
+		map[string]*ContainerState{"c1": {ID: "c1", State: StateRunning}, "c2": {ID: "c2", State: StateExited}},
+		map[string]*ImageState{"i1": {ID: "i1", Tags: []string{"acme/api:latest"}}},
+		now,
+	)
+	if len(changes) != 3 {
+		t.Fatalf("got %d events for a first sync, want 3: %+v", len(changes), changes)
+	}
+
+	changes = w.replace(
+		map[string]*ContainerState{"c1": {ID: "c1", State: StateRunning}, "c3": {ID: "c3", State: StateCreated}},
+		map[string]*ImageState{"i1": {ID: "i1", Tags: []string{"acme/api:latest", "acme/api:v2"}}, "i2": {ID: "i2"}},
+		now,
+	)
+	got := make(map[string]Event, len(changes))
+	for _, e := range changes {
+		got[e.ID] = e
+	}
+	if len(got) != 4 {
+		t.Fatalf("got events %+v, want ones for c2, c3, i1 and i2", changes)
+	}
+	if _, ok := got["c1"]; ok {
+		t.Error("unchanged container reported")
+	}
+	if e := got["c2"]; e.Action != "destroy" || e.Container.State != StateRemoved {
+		t.Errorf("got %+v for a removed container", e)
+	}
+	if e := got["c3"]; e.Action != "sync" || e.Container.State != StateCreated {
+		t.Errorf("got %+v for a new container", e)
+	}
+	if e := got["i1"]; e.Action != "sync" || len(e.Image.Tags) != 2 {
+		t.Errorf("got %+v for a retagged image", e)
+	}
+
+	changes = w.replace(map[string]*ContainerState{}, map[string]*ImageState{}, now)
+	deleted := 0
+	for _, e := range changes {
+		if e.Type == TypeImage && e.Action == "delete" {
+			deleted++
+		}
+	}
+	if deleted != 2 {
+		t.Errorf("got %d image deletions, want 2", deleted)
+	}
+}
+
+func TestListContainersNewestFirst(t *testing.T) {
+	w := NewEngineWatcher(context.Background(), nil)
+	now := time.Now()
+	w.replace(map[string]*ContainerState{
+		"old": {ID: "old", UpdatedAt: now.Add(-time.Minute)},
+		"new": {ID: "new", UpdatedAt: now},
+	}, map[string]*ImageState{}, now)
+
+	containers := w.ListContainers()
+	if len(containers) != 2 || containers[0].ID != "new" || containers[1].ID != "old" {
+		t.Fatalf("got %+v, want new before old", containers)
+	}
+	containers[0].State = StateRemoved
+	if w.ListContainers()[0].State == StateRemoved {
+		t.Error("ListContainers returned the watcher's own state")
+	}
+}
+
+func TestIsTrackedImage(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{labels: map[string]string{buildpackLabel: "{}"}, want: true},
+		{labels: map[string]string{run.LabelManaged: "true"}, want: true},
+		// Snapshots blank the managed label
+		{labels: map[string]string{run.LabelManaged: ""}, want: false},
+		{labels: map[string]string{"maintainer": "acme"}, want: false},
+		{labels: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := isTrackedImage(tt.labels); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeState(t *testing.T) {
+	tests := map[string]string{
+		"running":    StateRunning,
+		"restarting": StateRunning,
+		"paused":     StatePaused,
+		"created":    StateCreated,
+		"removing":   StateRemoved,
+		"exited":     StateExited,
+		"dead":       StateExited,
+	}
+	for state, want := range tests {
+		if got := normalizeState(state); got != want {
+			t.Errorf("%s: got %s, want %s", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package environment
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bskit/backend/run"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// healthTimeout bounds how long we wait for a service before giving up on the environment
+const healthTimeout = 2 * time.Minute
+
+type EnvironmentManager struct {
+	runs         *run.RunManager
+	ctx          context.Context
+	mu           sync.RWMutex
+	environments map[string]*Environment
+}
+
+// Environment is an app run together with the companion services it depends on
+type Environment struct {
+	ID      string `json:"id"`
+	Repo    string `json:"repo"`
+	Network string `json:"network"`
+	// Services maps service names to their run IDs
+	Services  map[string]string `json:"services"`
+	AppRunID  string            `json:"appRunId"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// StatusUpdate is emitted as an environment:status event while an environment starts
+type StatusUpdate struct {
+	EnvironmentID string `json:"environmentId"`
+	Service       string `json:"service"`
+	Status        string `json:"status"`
+	Message       string `json:"message,omitempty"`
+}
+
+func NewEnvironmentManager(ctx context.Context, runs *run.RunManager) *EnvironmentManager {
+	return &EnvironmentManager{
+		runs:         runs,
+		ctx:          ctx,
+		environments: make(map[string]*Environment),
+	}
+}
+
+// Start brings up the repo's companion services on a shared network, waits
+// for them to become healthy and then starts the app with their connection
+// details in its environment.
+func (m *EnvironmentManager) Start(repoPath string, app run.Options) (*Environment, error) {
+	services, err := LoadServices(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	services, err = orderServices(services)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Environment{
+		ID:        fmt.Sprintf("%x", time.Now().UnixNano()),
+		Repo:      repoPath,
+		Services:  make(map[string]string),
+		CreatedAt: time.Now(),
+	}
+	env.Network = "bskit-" + env.ID
+
+	labels := map[string]string{
+		run.LabelManaged:     "true",
+		run.LabelEnvironment: env.ID,
+		run.LabelRepo:        repoPath,
+	}
+	if _, err := m.runs.DockerClient().NetworkCreate(m.ctx, env.Network, network.CreateOptions{Labels: labels}); err != nil {
+		return nil, fmt.Errorf("failed to create network: %w", err)
+	}
+
+	m.mu.Lock()
+	m.environments[env.ID] = env
+	m.mu.Unlock()
+
+	fail := func(err error) (*Environment, error) {
+		if teardownErr := m.Teardown(env.ID); teardownErr != nil {
+			log.Printf("Failed to tear down environment %s: %v", env.ID, teardownErr)
+		}
+		return nil, err
+	}
+
+	appEnv := make(map[string]string)
+	for _, svc := range services {
+		m.emitStatus(env.ID, svc.Name, "starting", "")
+
+		r, err := m.runs.Start(run.Options{
+			Image:       svc.Image,
+			Name:        env.Network + "-" + svc.Name,
+			Repo:        repoPath,
+			Env:         svc.Env,
+			Ports:       svc.Ports,
+			Volumes:     resolveVolumes(repoPath, svc.Volumes),
+			Network:     env.Network,
+			Aliases:     []string{svc.Name},
+			HealthCheck: svc.HealthCheck,
+			Labels: map[string]string{
+				run.LabelEnvironment: env.ID,
+				run.LabelService:     svc.Name,
+			},
+		})
+		if err != nil {
+			m.emitStatus(env.ID, svc.Name, "failed", err.Error())
+			return fail(fmt.Errorf("failed to start service %s: %w", svc.Name, err))
+		}
+
+		m.mu.Lock()
+		env.Services[svc.Name] = r.ID
+		m.mu.Unlock()
+
+		if err := m.runs.WaitHealthy(r.ID, healthTimeout); err != nil {
+			m.emitStatus(env.ID, svc.Name, "failed", err.Error())
+			return fail(err)
+		}
+		m.emitStatus(env.ID, svc.Name, "healthy", "")
+
+		for k, v := range svc.connectionEnv() {
+			appEnv[k] = v
+		}
+	}
+
+	// Explicit app settings win over the generated connection variables
+	for k, v := range app.Env {
+		appEnv[k] = v
+	}
+	app.Env = appEnv
+	app.Repo = repoPath
+	app.Network = env.Network
+	app.Aliases = append(app.Aliases, "app")
+	if app.Labels == nil {
+		app.Labels = make(map[string]string)
+	}
+	app.Labels[run.LabelEnvironment] = env.ID
+
+	m.emitStatus(env.ID, "app", "starting", "")
+	appRun, err := m.runs.Start(app)
+	if err != nil {
+		m.emitStatus(env.ID, "app", "failed", err.Error())
+		return fail(fmt.Errorf("failed to start app: %w", err))
+	}
+	m.emitStatus(env.ID, "app", "running", "")
+
+	m.mu.Lock()
+	env.AppRunID = appRun.ID
+	m.mu.Unlock()
+
+	return m.Get(env.ID)
+}
+
+// Teardown stops every container of the environment and removes its network
+func (m *EnvironmentManager) Teardown(envID string) error {
+	m.mu.Lock()
+	env, ok := m.environments[envID]
+	delete(m.environments, envID)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("environment not found: %s", envID)
+	}
+
+	var errs []string
+	for _, r := range m.runs.ListByLabel(run.LabelEnvironment, envID) {
+		if err := m.runs.Stop(r.ID); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if err := m.runs.DockerClient().NetworkRemove(m.ctx, env.Network); err != nil && !errdefs.IsNotFound(err) {
+		errs = append(errs, fmt.Sprintf("failed to remove network: %v", err))
+	}
+
+	runtime.EventsEmit(m.ctx, "environment:stopped", envID)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to tear down environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Get returns a copy of the environment with the given ID
+func (m *EnvironmentManager) Get(envID string) (*Environment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	env, ok := m.environments[envID]
+	if !ok {
+		return nil, fmt.Errorf("environment not found: %s", envID)
+	}
+	return env.copy(), nil
+}
+
+// List returns all running environments, most recent first
+func (m *EnvironmentManager) List() []*Environment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	envs := make([]*Environment, 0, len(m.environments))
+	for _, env := range m.environments {
+		envs = append(envs, env.copy())
+	}
+	sort.Slice(envs, func(i, j int) bool {
+		return envs[i].CreatedAt.After(envs[j].CreatedAt)
+	})
+	return envs
+}
+
+func (m *EnvironmentManager) emitStatus(envID, service, status, message string) {
+	runtime.EventsEmit(m.ctx, "environment:status", StatusUpdate{
+		EnvironmentID: envID,
+		Service:       service,
+		Status:        status,
+		Message:       message,
+	})
+}
+
+func (e *Environment) copy() *Environment {
+	c := *e
+	c.Services = make(map[string]string, len(e.Services))
+	for k, v := range e.Services {
+		c.Services[k] = v
+	}
+	return &c
+}
+
+// resolveVolumes turns compose style volume specs into mounts. Relative host
+// paths are resolved against the repo and named volumes are scoped to the
+// repo, the same way compose prefixes them with the project name.
+func resolveVolumes(repoPath string, volumes []string) []run.VolumeMount {
+	mounts := make([]run.VolumeMount, 0, len(volumes))
+	for _, v := range volumes {
+		parts := splitVolumeSpec(v)
+		if len(parts) < 2 {
+			// Anonymous volumes are left to the image's own VOLUME declarations
+			continue
+		}
+
+		source := parts[0]
+		mount := run.VolumeMount{Target: parts[1]}
+		if len(parts) > 2 {
+			for _, opt := range strings.Split(parts[2], ",") {
+				mount.ReadOnly = mount.ReadOnly || opt == "ro"
+			}
+		}
+
+		switch {
+		case strings.HasPrefix(source, "~"):
+			if home, err := os.UserHomeDir(); err == nil {
+				source = filepath.Join(home, source[1:])
+			}
+			mount.HostPath = source
+		case strings.HasPrefix(source, "."):
+			mount.HostPath = filepath.Join(repoPath, source)
+		case filepath.IsAbs(source):
+			mount.HostPath = source
+		default:
+			mount.Name = source
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts
+}
+
+// splitVolumeSpec splits a compose volume into source, target and options,
+// keeping Windows drive letters (C:\data:/data) with the source
+func splitVolumeSpec(spec string) []string {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 2 && len(parts[0]) == 1 && isDriveLetter(parts[0][0]) &&
+		(strings.HasPrefix(parts[1], "\\") || strings.HasPrefix(parts[1], "/")) {
+		parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+	}
+	return parts
+}
+
+func isDriveLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
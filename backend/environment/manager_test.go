@@ -0,0 +1,27 @@
+package environment
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitVolumeSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"data", []string{"data"}},
+		{"data:/var/lib/data", []string{"data", "/var/lib/data"}},
+		{"./conf:/etc/app:ro", []string{"./conf", "/etc/app", "ro"}},
+		{`C:\data:/data`, []string{`C:\data`, "/data"}},
+		{"c:/data:/data:rw", []string{"c:/data", "/data", "rw"}},
+		{"c:data", []string{"c", "data"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if got := splitVolumeSpec(tt.spec); !slices.Equal(got, tt.want) {
+				t.Errorf("splitVolumeSpec(%q) = %q, want %q", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,519 @@
+package environment
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bskit/backend/run"
+
+	"gopkg.in/yaml.v3"
+)
+
+// servicesFile is where the companion services of a repo are declared,
+// relative to the repo root
+const servicesFile = ".bskit/services.json"
+
+// composeFiles are the compose file names we look for, in order of preference
+var composeFiles = []string{
+	"compose.yaml",
+	"compose.yml",
+	"docker-compose.yaml",
+	"docker-compose.yml",
+}
+
+// ServiceSpec declares a companion service started alongside the app
+type ServiceSpec struct {
+	Name  string            `json:"name"`
+	Image string            `json:"image"`
+	Env   map[string]string `json:"env,omitempty"`
+	// Ports are published on the host, in the docker CLI format
+	Ports []string `json:"ports,omitempty"`
+	// Volumes use the compose format. Relative host paths are resolved
+	// against the repo and named volumes are scoped to the repo.
+	Volumes     []string         `json:"volumes,omitempty"`
+	HealthCheck *run.HealthCheck `json:"healthCheck,omitempty"`
+	DependsOn   []string         `json:"dependsOn,omitempty"`
+	// Connection holds environment variables injected into the app so it can
+	// reach this service. Values may reference ${host}, ${port} and any of
+	// the service's own environment variables.
+	Connection map[string]string `json:"connection,omitempty"`
+}
+
+// LoadServices returns the services declared for a repo. When the repo has
+// no declaration yet, services are imported from its compose file if present.
+func LoadServices(repoPath string) ([]ServiceSpec, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, servicesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			services, err := ImportCompose(repoPath)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			return services, nil
+		}
+		return nil, fmt.Errorf("failed to read services file: %w", err)
+	}
+
+	var services []ServiceSpec
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("failed to parse services file: %w", err)
+	}
+	return services, nil
+}
+
+// SaveServices writes the service declarations for a repo
+func SaveServices(repoPath string, services []ServiceSpec) error {
+	for _, svc := range services {
+		if svc.Name == "" || svc.Image == "" {
+			return fmt.Errorf("every service needs a name and an image")
+		}
+	}
+
+	path := filepath.Join(repoPath, servicesFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create services directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(services, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode services: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write services file: %w", err)
+	}
+	return nil
+}
+
+// composeFile is the subset of the compose specification we understand
+type composeFile struct {
+	Services map[string]struct {
+		Image       string    `yaml:"image"`
+		Build       yaml.Node `yaml:"build"`
+		Environment yaml.Node `yaml:"environment"`
+		Ports       yaml.Node `yaml:"ports"`
+		Volumes     yaml.Node `yaml:"volumes"`
+		DependsOn   yaml.Node `yaml:"depends_on"`
+		HealthCheck *struct {
+			Test        yaml.Node `yaml:"test"`
+			Interval    string    `yaml:"interval"`
+			Timeout     string    `yaml:"timeout"`
+			Retries     int       `yaml:"retries"`
+			StartPeriod string    `yaml:"start_period"`
+		} `yaml:"healthcheck"`
+	} `yaml:"services"`
+}
+
+// ImportCompose reads the services of the repo's compose file. Services that
+// are built from source rather than pulled from an image are skipped, since
+// that is the app bskit builds itself.
+func ImportCompose(repoPath string) ([]ServiceSpec, error) {
+	var data []byte
+	var err error
+	for _, name := range composeFiles {
+		data, err = os.ReadFile(filepath.Join(repoPath, name))
+		if err == nil || !os.IsNotExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var compose composeFile
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+
+	var services []ServiceSpec
+	for name, svc := range compose.Services {
+		if svc.Image == "" || !svc.Build.IsZero() {
+			continue
+		}
+
+		spec := ServiceSpec{
+			Name:  name,
+			Image: svc.Image,
+		}
+
+		spec.Ports, err = composePorts(&svc.Ports)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		spec.Volumes, err = composeVolumes(&svc.Volumes)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		spec.Env, err = composeEnvironment(&svc.Environment)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		spec.DependsOn, err = composeDependsOn(&svc.DependsOn)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		if hc := svc.HealthCheck; hc != nil {
+			spec.HealthCheck = &run.HealthCheck{Retries: hc.Retries}
+			switch hc.Test.Kind {
+			case yaml.ScalarNode:
+				spec.HealthCheck.Test = []string{"CMD-SHELL", hc.Test.Value}
+			case yaml.SequenceNode:
+				if err := hc.Test.Decode(&spec.HealthCheck.Test); err != nil {
+					return nil, fmt.Errorf("service %s: invalid healthcheck test: %w", name, err)
+				}
+			}
+			for _, d := range []struct {
+				value  string
+				target *time.Duration
+			}{
+				{hc.Interval, &spec.HealthCheck.Interval},
+				{hc.Timeout, &spec.HealthCheck.Timeout},
+				{hc.StartPeriod, &spec.HealthCheck.StartPeriod},
+			} {
+				if d.value == "" {
+					continue
+				}
+				if *d.target, err = time.ParseDuration(d.value); err != nil {
+					return nil, fmt.Errorf("service %s: invalid healthcheck duration %q", name, d.value)
+				}
+			}
+		}
+
+		services = append(services, spec)
+	}
+
+	return orderServices(services)
+}
+
+// composeEnvironment accepts both the map and the list form of environment
+func composeEnvironment(node *yaml.Node) (map[string]string, error) {
+	env := make(map[string]string)
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.MappingNode:
+		var values map[string]interface{}
+		if err := node.Decode(&values); err != nil {
+			return nil, fmt.Errorf("invalid environment: %w", err)
+		}
+		for k, v := range values {
+			if v == nil {
+				env[k] = ""
+				continue
+			}
+			env[k] = fmt.Sprint(v)
+		}
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return nil, fmt.Errorf("invalid environment: %w", err)
+		}
+		for _, v := range values {
+			k, val, _ := strings.Cut(v, "=")
+			env[k] = val
+		}
+	default:
+		return nil, fmt.Errorf("invalid environment")
+	}
+	return env, nil
+}
+
+// composePorts accepts both the short ("8080:80") and the long syntax of
+// ports, returning them in the docker CLI format
+func composePorts(node *yaml.Node) ([]string, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("invalid ports")
+	}
+
+	var ports []string
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			ports = append(ports, item.Value)
+			continue
+		}
+
+		var port struct {
+			Target    string `yaml:"target"`
+			Published string `yaml:"published"`
+			HostIP    string `yaml:"host_ip"`
+			Protocol  string `yaml:"protocol"`
+		}
+		if err := item.Decode(&port); err != nil {
+			return nil, fmt.Errorf("invalid port: %w", err)
+		}
+		if port.Target == "" {
+			return nil, fmt.Errorf("invalid port: target is required")
+		}
+
+		spec := port.Target
+		if port.Published != "" || port.HostIP != "" {
+			spec = port.Published + ":" + spec
+		}
+		if port.HostIP != "" {
+			spec = port.HostIP + ":" + spec
+		}
+		if port.Protocol != "" {
+			spec += "/" + port.Protocol
+		}
+		ports = append(ports, spec)
+	}
+	return ports, nil
+}
+
+// composeVolumes accepts both the short ("data:/var/lib/data:ro") and the
+// long syntax of volumes, returning them in the short syntax
+func composeVolumes(node *yaml.Node) ([]string, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("invalid volumes")
+	}
+
+	var volumes []string
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			volumes = append(volumes, item.Value)
+			continue
+		}
+
+		var volume struct {
+			Type     string `yaml:"type"`
+			Source   string `yaml:"source"`
+			Target   string `yaml:"target"`
+			ReadOnly bool   `yaml:"read_only"`
+		}
+		if err := item.Decode(&volume); err != nil {
+			return nil, fmt.Errorf("invalid volume: %w", err)
+		}
+		switch volume.Type {
+		case "", "volume", "bind":
+		default:
+			return nil, fmt.Errorf("%s volumes are not supported", volume.Type)
+		}
+		if volume.Target == "" {
+			return nil, fmt.Errorf("invalid volume: target is required")
+		}
+
+		spec := volume.Target
+		if volume.Source != "" {
+			spec = volume.Source + ":" + spec
+		}
+		if volume.ReadOnly {
+			if volume.Source == "" {
+				return nil, fmt.Errorf("read only anonymous volumes are not supported")
+			}
+			spec += ":ro"
+		}
+		volumes = append(volumes, spec)
+	}
+	return volumes, nil
+}
+
+// composeDependsOn accepts both the list and the map form of depends_on
+func composeDependsOn(node *yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.SequenceNode:
+		var deps []string
+		if err := node.Decode(&deps); err != nil {
+			return nil, fmt.Errorf("invalid depends_on: %w", err)
+		}
+		return deps, nil
+	case yaml.MappingNode:
+		var deps []string
+		for i := 0; i < len(node.Content); i += 2 {
+			deps = append(deps, node.Content[i].Value)
+		}
+		return deps, nil
+	default:
+		return nil, fmt.Errorf("invalid depends_on")
+	}
+}
+
+// orderServices sorts services so that every service comes after the
+// services it depends on
+func orderServices(services []ServiceSpec) ([]ServiceSpec, error) {
+	byName := make(map[string]ServiceSpec, len(services))
+	names := make([]string, 0, len(services))
+	for _, svc := range services {
+		byName[svc.Name] = svc
+		names = append(names, svc.Name)
+	}
+	// Keep the output stable for services without dependencies
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var ordered []ServiceSpec
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle involving service %s", name)
+		case visited:
+			return nil
+		}
+		svc, ok := byName[name]
+		if !ok {
+			// Dependencies on services we don't run (e.g. the app itself) are ignored
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range svc.DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, svc)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// connectionEnv returns the environment variables that let the app reach the service
+func (s ServiceSpec) connectionEnv() map[string]string {
+	port := s.containerPort()
+	prefix := envName(s.Name)
+
+	env := map[string]string{
+		prefix + "_HOST": s.Name,
+	}
+	if port != "" {
+		env[prefix+"_PORT"] = port
+	}
+
+	for k, v := range wellKnownConnection(s, port) {
+		env[k] = v
+	}
+
+	for k, v := range s.Connection {
+		env[k] = os.Expand(v, func(key string) string {
+			switch key {
+			case "host":
+				return s.Name
+			case "port":
+				return port
+			}
+			return s.Env[key]
+		})
+	}
+
+	return env
+}
+
+// containerPort returns the first port the service listens on inside the network
+func (s ServiceSpec) containerPort() string {
+	if len(s.Ports) > 0 {
+		parts := strings.Split(s.Ports[0], ":")
+		port, _, _ := strings.Cut(parts[len(parts)-1], "/")
+		return port
+	}
+	if port, ok := defaultPorts[imageName(s.Image)]; ok {
+		return strconv.Itoa(port)
+	}
+	return ""
+}
+
+var defaultPorts = map[string]int{
+	"postgres":  5432,
+	"mysql":     3306,
+	"mariadb":   3306,
+	"redis":     6379,
+	"mongo":     27017,
+	"rabbitmq":  5672,
+	"memcached": 11211,
+}
+
+// wellKnownConnection builds the conventional connection URL for common images
+func wellKnownConnection(s ServiceSpec, port string) map[string]string {
+	get := func(key, fallback string) string {
+		if v := s.Env[key]; v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	// Credentials are escaped, since passwords often contain @, : or /
+	connURL := func(scheme string, user *url.Userinfo, path, query string) string {
+		u := url.URL{Scheme: scheme, User: user, Host: s.Name, Path: path, RawQuery: query}
+		if port != "" {
+			u.Host = net.JoinHostPort(s.Name, port)
+		}
+		return u.String()
+	}
+
+	switch imageName(s.Image) {
+	case "postgres":
+		user := get("POSTGRES_USER", "postgres")
+		return map[string]string{
+			"DATABASE_URL": connURL("postgres", url.UserPassword(user, get("POSTGRES_PASSWORD", "")),
+				"/"+get("POSTGRES_DB", user), "sslmode=disable"),
+		}
+	case "mysql", "mariadb":
+		return map[string]string{
+			"DATABASE_URL": connURL("mysql", url.UserPassword(get("MYSQL_USER", "root"), get("MYSQL_PASSWORD", get("MYSQL_ROOT_PASSWORD", ""))),
+				"/"+get("MYSQL_DATABASE", ""), ""),
+		}
+	case "redis":
+		return map[string]string{
+			"REDIS_URL": connURL("redis", nil, "", ""),
+		}
+	case "mongo":
+		return map[string]string{
+			"MONGODB_URI": connURL("mongodb", nil, "", ""),
+		}
+	case "rabbitmq":
+		return map[string]string{
+			"AMQP_URL": connURL("amqp", url.UserPassword(get("RABBITMQ_DEFAULT_USER", "guest"), get("RABBITMQ_DEFAULT_PASS", "guest")), "", ""),
+		}
+	}
+	return nil
+}
+
+// imageName strips the registry, namespace and tag from an image reference
+func imageName(ref string) string {
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	name, _, _ = strings.Cut(name, "@")
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// envName turns a service name into an environment variable prefix
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,219 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxRecords bounds the size of the history file
+const maxRecords = 500
+
+// Build statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type HistoryStore struct {
+	path    string
+	mu      sync.RWMutex
+	records []*BuildRecord
+}
+
+// BuildRecord describes a single build and everything we learned about the
+// image it produced
+type BuildRecord struct {
+	ID         string        `json:"id"`
+	Repo       string        `json:"repo"`
+	Image      string        `json:"image"`
+	Platform   string        `json:"platform"`
+	Commit     string        `json:"commit,omitempty"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  time.Time     `json:"startedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Tests      []TestResult  `json:"tests,omitempty"`
+	Smoke      []SmokeResult `json:"smoke,omitempty"`
+}
+
+// TestResult is the outcome of running a test suite against a build
+type TestResult struct {
+	Command    []string  `json:"command"`
+	Passed     bool      `json:"passed"`
+	ExitCode   int       `json:"exitCode"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Output     string    `json:"output,omitempty"`
+}
+
+// SmokeResult is the outcome of running the smoke checks against a run of a build
+type SmokeResult struct {
+	RunID      string        `json:"runId"`
+	Passed     bool          `json:"passed"`
+	StartedAt  time.Time     `json:"startedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+// CheckResult is the outcome of a single smoke check
+type CheckResult struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Status     int    `json:"status,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewHistoryStore loads the build history from the user's config directory
+func NewHistoryStore() (*HistoryStore, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	dir := filepath.Join(configDir, "bskit")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	s := &HistoryStore{path: filepath.Join(dir, "history.json")}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read build history: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			return nil, fmt.Errorf("failed to parse build history: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// StartBuild records the start of a build and returns its record
+func (s *HistoryStore) StartBuild(repo, image, platform, commit string) (*BuildRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := &BuildRecord{
+		ID:        fmt.Sprintf("%x", time.Now().UnixNano()),
+		Repo:      repo,
+		Image:     image,
+		Platform:  platform,
+		Commit:    commit,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+	}
+	s.records = append(s.records, record)
+	if len(s.records) > maxRecords {
+		s.records = s.records[len(s.records)-maxRecords:]
+	}
+
+	c := *record
+	return &c, s.save()
+}
+
+// FinishBuild marks a build as finished, failed if buildErr is not nil
+func (s *HistoryStore) FinishBuild(buildID string, buildErr error) error {
+	return s.update(buildID, func(r *BuildRecord) {
+		r.DurationMs = time.Since(r.StartedAt).Milliseconds()
+		r.Status = StatusSucceeded
+		if buildErr != nil {
+			r.Status = StatusFailed
+			r.Error = buildErr.Error()
+		}
+	})
+}
+
+// AddTestResult attaches a test result to a build
+func (s *HistoryStore) AddTestResult(buildID string, result TestResult) error {
+	return s.update(buildID, func(r *BuildRecord) {
+		r.Tests = append(r.Tests, result)
+	})
+}
+
+// AddSmokeResult attaches a smoke test result to a build
+func (s *HistoryStore) AddSmokeResult(buildID string, result SmokeResult) error {
+	return s.update(buildID, func(r *BuildRecord) {
+		r.Smoke = append(r.Smoke, result)
+	})
+}
+
+// Get returns the build with the given ID
+func (s *HistoryStore) Get(buildID string) (*BuildRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.records {
+		if r.ID == buildID {
+			c := *r
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("build not found: %s", buildID)
+}
+
+// List returns the builds of a repo, most recent first. An empty repo lists every build.
+func (s *HistoryStore) List(repo string) []*BuildRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []*BuildRecord
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if repo == "" || s.records[i].Repo == repo {
+			c := *s.records[i]
+			records = append(records, &c)
+		}
+	}
+	return records
+}
+
+// LatestForImage returns the most recent build that produced the given image
+func (s *HistoryStore) LatestForImage(image string) (*BuildRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i := len(s.records) - 1; i >= 0; i-- {
+		if s.records[i].Image == image {
+			c := *s.records[i]
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("no build found for image %s", image)
+}
+
+func (s *HistoryStore) update(buildID string, fn func(r *BuildRecord)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.records {
+		if r.ID == buildID {
+			fn(r)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("build not found: %s", buildID)
+}
+
+// save writes the history to disk. Callers must hold the write lock.
+func (s *HistoryStore) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build history: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build history: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write build history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,515 @@
+package load
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bskit/backend/run"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Limits keep a local test from overwhelming the machine running bskit
+const (
+	maxConcurrency = 256
+	maxDuration    = 10 * time.Minute
+	maxRate        = 100000
+	// maxErrorSamples is the number of distinct error messages kept per test
+	maxErrorSamples = 10
+)
+
+// Test statuses
+const (
+	StatusRunning   = "running"
+	StatusFinished  = "finished"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+)
+
+type LoadGenerator struct {
+	ctx        context.Context
+	runManager *run.RunManager
+	mu         sync.RWMutex
+	tests      map[string]*test
+}
+
+// Options configures a load test against a run
+type Options struct {
+	RunID   string            `json:"runId"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// Concurrency is the number of parallel workers, 10 by default
+	Concurrency int `json:"concurrency"`
+	// DurationSec is how long the test runs, 30 seconds by default
+	DurationSec int `json:"durationSec"`
+	// Rate caps the total requests per second, 0 for as fast as possible
+	Rate int `json:"rate"`
+}
+
+// Latency percentiles in milliseconds
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// ResourceUsage summarises the container stats sampled while the test ran
+type ResourceUsage struct {
+	CPUAvg    float64 `json:"cpuAvg"`
+	CPUMax    float64 `json:"cpuMax"`
+	MemoryMax uint64  `json:"memoryMax"`
+	// NetworkRx and NetworkTx are the bytes the container received and sent during the test
+	NetworkRx uint64            `json:"networkRx"`
+	NetworkTx uint64            `json:"networkTx"`
+	Samples   []run.StatsSample `json:"samples"`
+}
+
+// Result is the outcome of a load test, emitted as a load:finished event
+type Result struct {
+	ID         string    `json:"id"`
+	RunID      string    `json:"runId"`
+	URL        string    `json:"url"`
+	Options    Options   `json:"options"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+	Requests   int64     `json:"requests"`
+	// Errors counts failed requests and responses with a 4xx or 5xx status
+	Errors       int64         `json:"errors"`
+	StatusCodes  map[int]int64 `json:"statusCodes"`
+	ErrorSamples []string      `json:"errorSamples,omitempty"`
+	// Throughput is in requests per second
+	Throughput float64       `json:"throughput"`
+	Latency    Latency       `json:"latency"`
+	Resources  ResourceUsage `json:"resources"`
+}
+
+// Progress is emitted as a load:progress event every second while a test runs
+type Progress struct {
+	ID         string           `json:"id"`
+	ElapsedMs  int64            `json:"elapsedMs"`
+	Requests   int64            `json:"requests"`
+	Errors     int64            `json:"errors"`
+	Throughput float64          `json:"throughput"`
+	Stats      *run.StatsSample `json:"stats,omitempty"`
+}
+
+type test struct {
+	result   Result
+	cancel   context.CancelFunc
+	requests atomic.Int64
+	errors   atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	codes     map[int]int64
+	errorMsgs map[string]struct{}
+	samples   []run.StatsSample
+}
+
+func NewLoadGenerator(ctx context.Context, runManager *run.RunManager) *LoadGenerator {
+	return &LoadGenerator{
+		ctx:        ctx,
+		runManager: runManager,
+		tests:      make(map[string]*test),
+	}
+}
+
+// Start begins a load test against a run in the background
+func (g *LoadGenerator) Start(opts Options) (*Result, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodGet
+	}
+	opts.Method = strings.ToUpper(opts.Method)
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if !strings.HasPrefix(opts.Path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 10
+	}
+	if opts.Concurrency > maxConcurrency {
+		return nil, fmt.Errorf("concurrency is limited to %d", maxConcurrency)
+	}
+	if opts.DurationSec <= 0 {
+		opts.DurationSec = 30
+	}
+	duration := time.Duration(opts.DurationSec) * time.Second
+	if duration > maxDuration {
+		return nil, fmt.Errorf("duration is limited to %s", maxDuration)
+	}
+	if opts.Rate < 0 || opts.Rate > maxRate {
+		return nil, fmt.Errorf("rate must be between 0 and %d requests per second", maxRate)
+	}
+
+	address, err := g.runManager.HostPort(opts.RunID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(g.ctx, duration)
+	t := &test{
+		result: Result{
+			ID:        fmt.Sprintf("%x", time.Now().UnixNano()),
+			RunID:     opts.RunID,
+			URL:       "http://" + address + opts.Path,
+			Options:   opts,
+			Status:    StatusRunning,
+			StartedAt: time.Now(),
+		},
+		cancel:    cancel,
+		codes:     make(map[int]int64),
+		errorMsgs: make(map[string]struct{}),
+	}
+
+	g.mu.Lock()
+	for _, other := range g.tests {
+		if other.result.RunID == opts.RunID && other.result.Status == StatusRunning {
+			g.mu.Unlock()
+			cancel()
+			return nil, fmt.Errorf("a load test is already running against %s", opts.RunID)
+		}
+	}
+	g.tests[t.result.ID] = t
+	result := t.result
+	g.mu.Unlock()
+
+	go g.execute(ctx, t)
+	return &result, nil
+}
+
+// Stop cancels a running load test. The partial result is still reported.
+func (g *LoadGenerator) Stop(testID string) error {
+	g.mu.Lock()
+	t, ok := g.tests[testID]
+	if ok && t.result.Status == StatusRunning {
+		t.result.Status = StatusCancelled
+	}
+	g.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("load test not found: %s", testID)
+	}
+
+	t.cancel()
+	return nil
+}
+
+// Get returns the result of a load test, partial while it is still running
+func (g *LoadGenerator) Get(testID string) (*Result, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	t, ok := g.tests[testID]
+	if !ok {
+		return nil, fmt.Errorf("load test not found: %s", testID)
+	}
+	result := t.result
+	result.Requests = t.requests.Load()
+	result.Errors = t.errors.Load()
+	return &result, nil
+}
+
+// List returns the load tests of a run, most recent first. An empty runID lists every test.
+func (g *LoadGenerator) List(runID string) []*Result {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	results := make([]*Result, 0, len(g.tests))
+	for _, t := range g.tests {
+		if runID == "" || t.result.RunID == runID {
+			result := t.result
+			result.Requests = t.requests.Load()
+			result.Errors = t.errors.Load()
+			results = append(results, &result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].StartedAt.After(results[j].StartedAt)
+	})
+	return results
+}
+
+func (g *LoadGenerator) execute(ctx context.Context, t *test) {
+	defer t.cancel()
+	opts := t.result.Options
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.Concurrency,
+			MaxIdleConnsPerHost: opts.Concurrency,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		Timeout: 30 * time.Second,
+	}
+	defer client.CloseIdleConnections()
+
+	// With a rate limit, workers take a token from the ticker before every request
+	var tokens <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.worker(ctx, t, client, tokens)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	g.monitor(t, done)
+
+	g.finish(t)
+}
+
+func (g *LoadGenerator) worker(ctx context.Context, t *test, client *http.Client, tokens <-chan time.Time) {
+	opts := t.result.Options
+	var latencies []time.Duration
+	defer func() {
+		t.mu.Lock()
+		t.latencies = append(t.latencies, latencies...)
+		t.mu.Unlock()
+	}()
+
+	for {
+		if tokens != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tokens:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var body io.Reader
+		if opts.Body != "" {
+			body = strings.NewReader(opts.Body)
+		}
+		req, err := http.NewRequestWithContext(ctx, opts.Method, t.result.URL, body)
+		if err != nil {
+			t.recordError(err.Error())
+			return
+		}
+		for k, v := range opts.Headers {
+			req.Header.Set(k, v)
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Requests cut off by the end of the test don't count
+				return
+			}
+			t.requests.Add(1)
+			t.recordError(err.Error())
+			continue
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		latencies = append(latencies, time.Since(start))
+
+		t.requests.Add(1)
+		t.mu.Lock()
+		t.codes[resp.StatusCode]++
+		t.mu.Unlock()
+		if resp.StatusCode >= 400 {
+			t.recordError(fmt.Sprintf("HTTP %d", resp.StatusCode))
+		}
+	}
+}
+
+// monitor emits progress every second and collects the container stats
+// sampled during the test, until the workers are done
+func (g *LoadGenerator) monitor(t *test, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastRequests int64
+	for {
+		select {
+		case <-done:
+			g.collectStats(t)
+			return
+		case <-ticker.C:
+			latest := g.collectStats(t)
+			requests := t.requests.Load()
+			runtime.EventsEmit(g.ctx, "load:progress", Progress{
+				ID:         t.result.ID,
+				ElapsedMs:  time.Since(t.result.StartedAt).Milliseconds(),
+				Requests:   requests,
+				Errors:     t.errors.Load(),
+				Throughput: float64(requests - lastRequests),
+				Stats:      latest,
+			})
+			lastRequests = requests
+		}
+	}
+}
+
+// collectStats adds the run's stats samples taken since the last call and
+// returns the newest one. The run only keeps a short history, so samples are
+// copied out as the test goes.
+func (g *LoadGenerator) collectStats(t *test) *run.StatsSample {
+	samples, err := g.runManager.GetStats(t.result.RunID)
+	if err != nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := t.result.StartedAt
+	if n := len(t.samples); n > 0 {
+		since = t.samples[n-1].Time
+	}
+	for _, s := range samples {
+		if s.Time.After(since) {
+			t.samples = append(t.samples, s)
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	latest := samples[len(samples)-1]
+	return &latest
+}
+
+// finish computes the final result and emits it as a load:finished event
+func (g *LoadGenerator) finish(t *test) {
+	t.mu.Lock()
+	latencies := t.latencies
+	codes := make(map[int]int64, len(t.codes))
+	for code, n := range t.codes {
+		codes[code] = n
+	}
+	errorSamples := make([]string, 0, len(t.errorMsgs))
+	for msg := range t.errorMsgs {
+		errorSamples = append(errorSamples, msg)
+	}
+	resources := summarize(t.samples)
+	t.mu.Unlock()
+	sort.Strings(errorSamples)
+
+	elapsed := time.Since(t.result.StartedAt)
+
+	g.mu.Lock()
+	r := &t.result
+	if r.Status == StatusRunning {
+		r.Status = StatusFinished
+	}
+	r.DurationMs = elapsed.Milliseconds()
+	r.Requests = t.requests.Load()
+	r.Errors = t.errors.Load()
+	r.StatusCodes = codes
+	r.ErrorSamples = errorSamples
+	r.Throughput = float64(r.Requests) / elapsed.Seconds()
+	r.Latency = percentiles(latencies)
+	r.Resources = resources
+	if r.Requests == 0 && len(errorSamples) > 0 {
+		r.Status = StatusFailed
+		r.Error = errorSamples[0]
+	}
+	result := *r
+	g.mu.Unlock()
+
+	runtime.EventsEmit(g.ctx, "load:finished", result)
+}
+
+func (t *test) recordError(msg string) {
+	t.errors.Add(1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.errorMsgs) < maxErrorSamples {
+		t.errorMsgs[msg] = struct{}{}
+	}
+}
+
+func percentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	at := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(latencies)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return ms(latencies[i])
+	}
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	return Latency{
+		Min:  ms(latencies[0]),
+		Mean: ms(total / time.Duration(len(latencies))),
+		P50:  at(0.50),
+		P90:  at(0.90),
+		P95:  at(0.95),
+		P99:  at(0.99),
+		Max:  ms(latencies[len(latencies)-1]),
+	}
+}
+
+func summarize(samples []run.StatsSample) ResourceUsage {
+	usage := ResourceUsage{Samples: samples}
+	if len(samples) == 0 {
+		return usage
+	}
+
+	var cpuTotal float64
+	for _, s := range samples {
+		cpuTotal += s.CPUPercent
+		usage.CPUMax = math.Max(usage.CPUMax, s.CPUPercent)
+		if s.MemoryUsage > usage.MemoryMax {
+			usage.MemoryMax = s.MemoryUsage
+		}
+	}
+	usage.CPUAvg = cpuTotal / float64(len(samples))
+
+	// Network counters are cumulative for the life of the container
+	first, last := samples[0], samples[len(samples)-1]
+	if last.NetworkRx >= first.NetworkRx {
+		usage.NetworkRx = last.NetworkRx - first.NetworkRx
+	}
+	if last.NetworkTx >= first.NetworkTx {
+		usage.NetworkTx = last.NetworkTx - first.NetworkTx
+	}
+	return usage
+}
@@ -0,0 +1,56 @@
+package load
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	ms := func(values ...int) []time.Duration {
+		latencies := make([]time.Duration, len(values))
+		for i, v := range values {
+			latencies[i] = time.Duration(v) * time.Millisecond
+		}
+		return latencies
+	}
+	hundred := make([]int, 100)
+	for i := range hundred {
+		// Reversed, so percentiles has to sort
+		hundred[i] = 100 - i
+	}
+
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		want      Latency
+	}{
+		{name: "empty", latencies: nil, want: Latency{}},
+		{
+			name:      "single",
+			latencies: ms(7),
+			want:      Latency{Min: 7, Mean: 7, P50: 7, P90: 7, P95: 7, P99: 7, Max: 7},
+		},
+		{
+			name:      "unsorted",
+			latencies: ms(30, 10, 20, 40),
+			want:      Latency{Min: 10, Mean: 25, P50: 20, P90: 40, P95: 40, P99: 40, Max: 40},
+		},
+		{
+			name:      "hundred",
+			latencies: ms(hundred...),
+			want:      Latency{Min: 1, Mean: 50.5, P50: 50, P90: 90, P95: 95, P99: 99, Max: 100},
+		},
+		{
+			name:      "sub-millisecond",
+			latencies: []time.Duration{500 * time.Microsecond, 1500 * time.Microsecond},
+			want:      Latency{Min: 0.5, Mean: 1, P50: 0.5, P90: 1.5, P95: 1.5, P99: 1.5, Max: 1.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentiles(tt.latencies); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
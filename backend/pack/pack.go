@@ -38,7 +38,28 @@ func NewPackBuilder(ctx context.Context) (*PackBuilder, error) {
 	}, nil
 }
 
+// BuildOptions configures a single pack build
+type BuildOptions struct {
+	Path     string
+	Platform string
+	// ImageName defaults to the name of the source directory
+	ImageName string
+	// PullPolicy is passed to pack as --pull-policy when set, e.g. "if-not-present"
+	PullPolicy string
+}
+
 func (p *PackBuilder) Build(selectedDirectory, platform string) error {
+	return p.BuildWithOptions(BuildOptions{
+		Path:     selectedDirectory,
+		Platform: platform,
+	})
+}
+
+// BuildWithOptions runs pack build. Layers are cached in volumes keyed by the
+// image name, so repeated builds of the same image are incremental.
+func (p *PackBuilder) BuildWithOptions(opts BuildOptions) error {
+	selectedDirectory, platform := opts.Path, opts.Platform
+
 	// Validate selected directory exists
 	if _, err := os.Stat(selectedDirectory); os.IsNotExist(err) {
 		return fmt.Errorf("selected directory does not exist: %s", selectedDirectory)
@@ -46,6 +67,9 @@ func (p *PackBuilder) Build(selectedDirectory, platform string) error {
 
 	// Get repo name from directory
 	repoName := filepath.Base(selectedDirectory)
+	if opts.ImageName != "" {
+		repoName = opts.ImageName
+	}
 
 	// Use selected directory for Docker mount
 	absSelectedPath, err := filepath.Abs(selectedDirectory)
@@ -98,6 +122,9 @@ func (p *PackBuilder) Build(selectedDirectory, platform string) error {
 	buildArgs = append(buildArgs, "--builder", "paketobuildpacks/builder-jammy-base")
 	buildArgs = append(buildArgs, "--creation-time", "now")
 	buildArgs = append(buildArgs, "--platform", "linux/"+platform)
+	if opts.PullPolicy != "" {
+		buildArgs = append(buildArgs, "--pull-policy", opts.PullPolicy)
+	}
 
 	// Create container config
 	config := &container.Config{
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is the pipeline definition checked into a repo
+const ConfigFile = "bskit.yaml"
+
+// Step types
+const (
+	StepBuild   = "build"
+	StepTest    = "test"
+	StepScan    = "scan"
+	StepPublish = "publish"
+	StepRun     = "run"
+)
+
+// Config is the contents of bskit.yaml
+type Config struct {
+	// Image is the name of the built image, defaults to the repo directory name
+	Image string `yaml:"image" json:"image"`
+	// Platform is the build platform, arm64 or amd64
+	Platform string `yaml:"platform" json:"platform"`
+	Steps    []Step `yaml:"steps" json:"steps"`
+}
+
+// Step is a single unit of work in the pipeline
+type Step struct {
+	Name string `yaml:"name" json:"name"`
+	// Type is one of build, test, scan, publish or run; defaults to run
+	Type  string   `yaml:"type" json:"type"`
+	Needs []string `yaml:"needs" json:"needs"`
+	// Image overrides the container a test or run step executes in. By
+	// default they run in the built image.
+	Image string `yaml:"image" json:"image"`
+	// Run is a shell command for run steps
+	Run string `yaml:"run" json:"run"`
+	// Command is an argv for test and run steps
+	Command []string          `yaml:"command" json:"command"`
+	Env     map[string]string `yaml:"env" json:"env"`
+	// Cache lists paths that are kept between pipeline runs
+	Cache []string `yaml:"cache" json:"cache"`
+	// Severity is the comma separated list of severities that fail a scan
+	Severity string `yaml:"severity" json:"severity"`
+	// Tag is the registry reference a publish step pushes to
+	Tag string `yaml:"tag" json:"tag"`
+}
+
+// LoadConfig reads and validates the pipeline definition of a repo
+func LoadConfig(repoPath string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, ConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no %s found in %s", ConfigFile, repoPath)
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", ConfigFile, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ConfigFile, err)
+	}
+
+	if config.Image == "" {
+		config.Image = filepath.Base(repoPath)
+	}
+	if config.Platform == "" {
+		config.Platform = "amd64"
+	}
+	for i := range config.Steps {
+		if config.Steps[i].Type == "" {
+			config.Steps[i].Type = StepRun
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ConfigFile, err)
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	if c.Platform != "arm64" && c.Platform != "amd64" {
+		return fmt.Errorf("invalid platform %q", c.Platform)
+	}
+	if len(c.Steps) == 0 {
+		return fmt.Errorf("no steps defined")
+	}
+
+	steps := make(map[string]Step, len(c.Steps))
+	for _, step := range c.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("every step needs a name")
+		}
+		if _, ok := steps[step.Name]; ok {
+			return fmt.Errorf("duplicate step %q", step.Name)
+		}
+		steps[step.Name] = step
+
+		switch step.Type {
+		case StepBuild, StepTest, StepScan:
+		case StepPublish:
+			if step.Tag == "" {
+				return fmt.Errorf("step %q: publish steps need a tag", step.Name)
+			}
+		case StepRun:
+			if step.Run == "" && len(step.Command) == 0 {
+				return fmt.Errorf("step %q: run steps need a run or command", step.Name)
+			}
+		default:
+			return fmt.Errorf("step %q: unknown type %q", step.Name, step.Type)
+		}
+	}
+
+	for _, step := range c.Steps {
+		for _, dep := range step.Needs {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("step %q needs unknown step %q", step.Name, dep)
+			}
+		}
+	}
+
+	// Cycles would otherwise deadlock the runner
+	if _, err := orderSteps(c.Steps); err != nil {
+		return err
+	}
+	return nil
+}
+
+// orderSteps sorts steps so that every step comes after the steps it needs,
+// failing on dependency cycles
+func orderSteps(steps []Step) ([]Step, error) {
+	byName := make(map[string]Step, len(steps))
+	names := make([]string, 0, len(steps))
+	for _, step := range steps {
+		byName[step.Name] = step
+		names = append(names, step.Name)
+	}
+	// Keep the output stable for steps without dependencies
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var ordered []Step
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle involving step %q", name)
+		case visited:
+			return nil
+		}
+		step, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown step %q", name)
+		}
+		state[name] = visiting
+		for _, dep := range step.Needs {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		ordered = append(ordered, step)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
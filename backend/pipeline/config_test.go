@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name: "valid",
+			config: Config{Platform: "amd64", Steps: []Step{
+				{Name: "build", Type: StepBuild},
+				{Name: "test", Type: StepTest, Needs: []string{"build"}},
+				{Name: "publish", Type: StepPublish, Tag: "ghcr.io/acme/api", Needs: []string{"test"}},
+			}},
+		},
+		{
+			name:    "invalid platform",
+			config:  Config{Platform: "386", Steps: []Step{{Name: "build", Type: StepBuild}}},
+			wantErr: `invalid platform "386"`,
+		},
+		{
+			name:    "no steps",
+			config:  Config{Platform: "arm64"},
+			wantErr: "no steps defined",
+		},
+		{
+			name:    "missing name",
+			config:  Config{Platform: "amd64", Steps: []Step{{Type: StepBuild}}},
+			wantErr: "every step needs a name",
+		},
+		{
+			name: "duplicate step",
+			config: Config{Platform: "amd64", Steps: []Step{
+				{Name: "build", Type: StepBuild},
+				{Name: "build", Type: StepBuild},
+			}},
+			wantErr: `duplicate step "build"`,
+		},
+		{
+			name:    "publish without tag",
+			config:  Config{Platform: "amd64", Steps: []Step{{Name: "push", Type: StepPublish}}},
+			wantErr: "publish steps need a tag",
+		},
+		{
+			name:    "run without command",
+			config:  Config{Platform: "amd64", Steps: []Step{{Name: "lint", Type: StepRun}}},
+			wantErr: "run steps need a run or command",
+		},
+		{
+			name:    "unknown type",
+			config:  Config{Platform: "amd64", Steps: []Step{{Name: "deploy", Type: "deploy"}}},
+			wantErr: `unknown type "deploy"`,
+		},
+		{
+			name: "unknown need",
+			config: Config{Platform: "amd64", Steps: []Step{
+				{Name: "test", Type: StepTest, Needs: []string{"build"}},
+			}},
+			wantErr: `step "test" needs unknown step "build"`,
+		},
+		{
+			name: "cycle",
+			config: Config{Platform: "amd64", Steps: []Step{
+				{Name: "a", Type: StepBuild, Needs: []string{"c"}},
+				{Name: "b", Type: StepTest, Needs: []string{"a"}},
+				{Name: "c", Type: StepScan, Needs: []string{"b"}},
+			}},
+			wantErr: "dependency cycle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOrderSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+		want  []string
+	}{
+		{
+			name:  "independent steps are sorted by name",
+			steps: []Step{{Name: "scan"}, {Name: "build"}, {Name: "lint"}},
+			want:  []string{"build", "lint", "scan"},
+		},
+		{
+			name: "needs come first",
+			steps: []Step{
+				{Name: "publish", Needs: []string{"test", "scan"}},
+				{Name: "test", Needs: []string{"build"}},
+				{Name: "scan", Needs: []string{"build"}},
+				{Name: "build"},
+			},
+			want: []string{"build", "test", "scan", "publish"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := orderSteps(tt.steps)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, step := range ordered {
+				names = append(names, step.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("got %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "api")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "steps:\n  - name: lint\n    run: make lint\n"
+	if err := os.WriteFile(filepath.Join(dir, ConfigFile), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Image != "api" || c.Platform != "amd64" || c.Steps[0].Type != StepRun {
+		t.Errorf("defaults not applied: %+v", c)
+	}
+}
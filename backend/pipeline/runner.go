@@ -0,0 +1,429 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bskit/backend/dagger"
+	"bskit/backend/history"
+	"bskit/backend/pack"
+	"bskit/backend/repo"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Step and pipeline statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// defaultScanSeverity fails scans on serious vulnerabilities only
+const defaultScanSeverity = "HIGH,CRITICAL"
+
+type PipelineRunner struct {
+	ctx          context.Context
+	daggerRunner *dagger.Runner
+	packBuilder  *pack.PackBuilder
+	history      *history.HistoryStore
+	mu           sync.RWMutex
+	executions   map[string]*Execution
+}
+
+// Execution is a single run of a repo's pipeline
+type Execution struct {
+	ID         string        `json:"id"`
+	Repo       string        `json:"repo"`
+	Image      string        `json:"image"`
+	Status     string        `json:"status"`
+	StartedAt  time.Time     `json:"startedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Steps      []*StepStatus `json:"steps"`
+}
+
+// StepStatus is emitted as a pipeline:step event whenever a step changes state
+type StepStatus struct {
+	ExecutionID string    `json:"executionId"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Status      string    `json:"status"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	DurationMs  int64     `json:"durationMs"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// StepLog is emitted as a pipeline:log event for every line of step output
+type StepLog struct {
+	ExecutionID string `json:"executionId"`
+	Step        string `json:"step"`
+	Line        string `json:"line"`
+}
+
+func NewPipelineRunner(ctx context.Context, daggerRunner *dagger.Runner, packBuilder *pack.PackBuilder, historyStore *history.HistoryStore) *PipelineRunner {
+	return &PipelineRunner{
+		ctx:          ctx,
+		daggerRunner: daggerRunner,
+		packBuilder:  packBuilder,
+		history:      historyStore,
+		executions:   make(map[string]*Execution),
+	}
+}
+
+// Run starts the pipeline defined in the repo's bskit.yaml. Steps run as soon
+// as the steps they need have succeeded; steps whose dependencies failed are
+// skipped.
+func (p *PipelineRunner) Run(repoPath string) (*Execution, error) {
+	absPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	config, err := LoadConfig(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	exec := &Execution{
+		ID:        fmt.Sprintf("%x", time.Now().UnixNano()),
+		Repo:      absPath,
+		Image:     config.Image,
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+	}
+	for _, step := range config.Steps {
+		exec.Steps = append(exec.Steps, &StepStatus{
+			ExecutionID: exec.ID,
+			Name:        step.Name,
+			Type:        step.Type,
+			Status:      StatusPending,
+		})
+	}
+
+	p.mu.Lock()
+	p.executions[exec.ID] = exec
+	p.mu.Unlock()
+
+	go p.execute(exec, config)
+
+	return p.Get(exec.ID)
+}
+
+// Get returns a copy of the execution with the given ID
+func (p *PipelineRunner) Get(executionID string) (*Execution, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	exec, ok := p.executions[executionID]
+	if !ok {
+		return nil, fmt.Errorf("pipeline execution not found: %s", executionID)
+	}
+	return exec.copy(), nil
+}
+
+// List returns the executions of a repo, most recent first. An empty repo lists all of them.
+func (p *PipelineRunner) List(repoPath string) []*Execution {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var execs []*Execution
+	for _, exec := range p.executions {
+		if repoPath == "" || exec.Repo == repoPath {
+			execs = append(execs, exec.copy())
+		}
+	}
+	sort.Slice(execs, func(i, j int) bool {
+		return execs[i].StartedAt.After(execs[j].StartedAt)
+	})
+	return execs
+}
+
+func (p *PipelineRunner) execute(exec *Execution, config *Config) {
+	done := make(map[string]chan struct{}, len(config.Steps))
+	for _, step := range config.Steps {
+		done[step.Name] = make(chan struct{})
+	}
+
+	// buildID links test results to the build record of this execution
+	var buildID string
+	var buildMu sync.Mutex
+
+	var wg sync.WaitGroup
+	for i, step := range config.Steps {
+		wg.Add(1)
+		go func(step Step, status *StepStatus) {
+			defer wg.Done()
+			defer close(done[step.Name])
+
+			for _, dep := range step.Needs {
+				<-done[dep]
+				if p.stepStatus(exec, dep) != StatusSucceeded {
+					p.setStep(status, StatusSkipped, fmt.Sprintf("dependency %s did not succeed", dep))
+					return
+				}
+			}
+
+			p.setStep(status, StatusRunning, "")
+
+			var err error
+			switch step.Type {
+			case StepBuild:
+				var id string
+				id, err = p.runBuild(exec, config)
+				buildMu.Lock()
+				buildID = id
+				buildMu.Unlock()
+			case StepTest:
+				buildMu.Lock()
+				id := buildID
+				buildMu.Unlock()
+				err = p.runTest(exec, step, id)
+			case StepScan:
+				err = p.runScan(exec, step)
+			case StepPublish:
+				err = p.runPublish(exec, step)
+			case StepRun:
+				err = p.runCommand(exec, step)
+			}
+
+			if err != nil {
+				p.setStep(status, StatusFailed, err.Error())
+				return
+			}
+			p.setStep(status, StatusSucceeded, "")
+		}(step, exec.Steps[i])
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	exec.Status = StatusSucceeded
+	for _, s := range exec.Steps {
+		if s.Status != StatusSucceeded {
+			exec.Status = StatusFailed
+			break
+		}
+	}
+	exec.DurationMs = time.Since(exec.StartedAt).Milliseconds()
+	result := exec.copy()
+	p.mu.Unlock()
+
+	runtime.EventsEmit(p.ctx, "pipeline:finished", result)
+}
+
+func (p *PipelineRunner) runBuild(exec *Execution, config *Config) (string, error) {
+	var buildID string
+	record, err := p.history.StartBuild(exec.Repo, config.Image, config.Platform, repo.HeadCommit(exec.Repo))
+	if err != nil {
+		log.Printf("Failed to record build: %v", err)
+	} else {
+		buildID = record.ID
+	}
+
+	err = p.packBuilder.BuildWithOptions(pack.BuildOptions{
+		Path:      exec.Repo,
+		Platform:  config.Platform,
+		ImageName: config.Image,
+	})
+
+	if buildID != "" {
+		if err := p.history.FinishBuild(buildID, err); err != nil {
+			log.Printf("Failed to record build result: %v", err)
+		}
+	}
+	return buildID, err
+}
+
+func (p *PipelineRunner) runTest(exec *Execution, step Step, buildID string) error {
+	opts := dagger.TestOptions{
+		Image:      exec.Image,
+		SourcePath: exec.Repo,
+		Command:    step.Command,
+		Env:        step.Env,
+		Caches:     p.caches(exec, step),
+		Output:     p.stepOutput(exec, step),
+	}
+	if step.Image != "" {
+		opts.UseBuilder = true
+		opts.BuilderImage = step.Image
+	}
+
+	result, err := p.daggerRunner.RunTests(opts)
+	if err != nil {
+		return err
+	}
+
+	if buildID != "" {
+		if err := p.history.AddTestResult(buildID, history.TestResult{
+			Command:    result.Command,
+			Passed:     result.Passed,
+			ExitCode:   result.ExitCode,
+			StartedAt:  result.StartedAt,
+			DurationMs: result.DurationMs,
+			Output:     result.Output,
+		}); err != nil {
+			log.Printf("Failed to record test result: %v", err)
+		}
+	}
+
+	if !result.Passed {
+		return fmt.Errorf("tests failed with exit code %d", result.ExitCode)
+	}
+	return nil
+}
+
+func (p *PipelineRunner) runScan(exec *Execution, step Step) error {
+	severity := step.Severity
+	if severity == "" {
+		severity = defaultScanSeverity
+	}
+
+	image := step.Image
+	if image == "" {
+		image = "aquasec/trivy:latest"
+	}
+
+	res, err := p.daggerRunner.Exec(dagger.ExecOptions{
+		Image:        image,
+		DockerSocket: true,
+		Command: []string{
+			"trivy", "image", "--exit-code", "1", "--no-progress",
+			"--severity", severity, exec.Image,
+		},
+		Env: step.Env,
+		// Keep the vulnerability database between scans
+		Caches:  map[string]string{"/root/.cache/trivy": "bskit-trivy-cache"},
+		NoCache: true,
+		Output:  p.stepOutput(exec, step),
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("scan found %s vulnerabilities", severity)
+	}
+	return nil
+}
+
+func (p *PipelineRunner) runPublish(exec *Execution, step Step) error {
+	ref, err := p.daggerRunner.Publish(exec.Image, step.Tag)
+	if err != nil {
+		return err
+	}
+	p.emitLog(exec, step, "Published "+ref)
+	return nil
+}
+
+func (p *PipelineRunner) runCommand(exec *Execution, step Step) error {
+	opts := dagger.ExecOptions{
+		Command: step.Command,
+		Env:     step.Env,
+		Caches:  p.caches(exec, step),
+		Output:  p.stepOutput(exec, step),
+	}
+	if len(opts.Command) == 0 {
+		opts.Command = []string{"sh", "-c", step.Run}
+	}
+	if step.Image != "" {
+		opts.Image = step.Image
+		opts.SourcePath = exec.Repo
+	} else {
+		// The built image runs in its own app directory, which already
+		// holds the source and everything the buildpacks installed
+		opts.LocalImage = exec.Image
+		opts.UseLauncher = true
+		opts.Workdir = dagger.AppDir
+	}
+
+	res, err := p.daggerRunner.Exec(opts)
+	if err != nil {
+		return err
+	}
+
+	if res.ExitCode != 0 {
+		return fmt.Errorf("exited with code %d", res.ExitCode)
+	}
+	return nil
+}
+
+// caches names one cache volume per repo, step and path
+func (p *PipelineRunner) caches(exec *Execution, step Step) map[string]string {
+	if len(step.Cache) == 0 {
+		return nil
+	}
+
+	caches := make(map[string]string, len(step.Cache))
+	for _, path := range step.Cache {
+		key := strings.NewReplacer("/", "-", " ", "-").Replace(strings.Trim(path, "/"))
+		caches[path] = fmt.Sprintf("bskit-%s-%s-%s", filepath.Base(exec.Repo), step.Name, key)
+	}
+	return caches
+}
+
+func (p *PipelineRunner) stepStatus(exec *Execution, name string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, s := range exec.Steps {
+		if s.Name == name {
+			return s.Status
+		}
+	}
+	return ""
+}
+
+func (p *PipelineRunner) setStep(status *StepStatus, state, message string) {
+	p.mu.Lock()
+	switch state {
+	case StatusRunning:
+		status.StartedAt = time.Now()
+	case StatusSucceeded, StatusFailed:
+		status.DurationMs = time.Since(status.StartedAt).Milliseconds()
+	}
+	status.Status = state
+	status.Error = message
+	update := *status
+	p.mu.Unlock()
+
+	runtime.EventsEmit(p.ctx, "pipeline:step", update)
+}
+
+func (p *PipelineRunner) emitLog(exec *Execution, step Step, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		runtime.EventsEmit(p.ctx, "pipeline:log", StepLog{
+			ExecutionID: exec.ID,
+			Step:        step.Name,
+			Line:        line,
+		})
+	}
+}
+
+// stepOutput emits the output of a step's own container as pipeline:log
+// events, so steps running in parallel don't get each other's lines
+func (p *PipelineRunner) stepOutput(exec *Execution, step Step) func(line string) {
+	return func(line string) {
+		p.emitLog(exec, step, line)
+	}
+}
+
+// copy returns a deep copy of the execution. Callers must hold the lock.
+func (e *Execution) copy() *Execution {
+	c := *e
+	c.Steps = make([]*StepStatus, len(e.Steps))
+	for i, s := range e.Steps {
+		step := *s
+		c.Steps[i] = &step
+	}
+	return &c
+}
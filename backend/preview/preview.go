@@ -0,0 +1,398 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bskit/backend/history"
+	"bskit/backend/pack"
+	"bskit/backend/repo"
+	"bskit/backend/run"
+	"bskit/backend/smoke"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// LabelPreview holds the name of the preview a run belongs to
+const LabelPreview = "bskit.preview"
+
+// defaultPort is the port buildpack web processes listen on unless told otherwise
+const defaultPort = 3000
+
+// Preview statuses
+const (
+	StatusFetching = "fetching"
+	StatusBuilding = "building"
+	StatusStarting = "starting"
+	StatusRunning  = "running"
+	StatusFailed   = "failed"
+)
+
+type PreviewManager struct {
+	ctx         context.Context
+	repos       *repo.RepoManager
+	packBuilder *pack.PackBuilder
+	runManager  *run.RunManager
+	history     *history.HistoryStore
+	smoke       *smoke.SmokeRunner
+	mu          sync.RWMutex
+	previews    map[string]*Preview
+}
+
+// Options selects what to preview. Exactly one of Branch and PullRequest is set.
+type Options struct {
+	Repo        string `json:"repo"`
+	Branch      string `json:"branch"`
+	PullRequest int    `json:"pullRequest"`
+	// Name defaults to <repo>-<branch> or <repo>-pr-<number>
+	Name     string `json:"name"`
+	Platform string `json:"platform"`
+	// Port is the container port the app listens on, 3000 by default
+	Port int               `json:"port"`
+	Env  map[string]string `json:"env"`
+}
+
+// Preview is a branch or pull request checked out, built and running on its own
+type Preview struct {
+	Name   string `json:"name"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// Ref is the ref fetched from origin, e.g. feature/login or pull/42/head
+	Ref      string `json:"ref"`
+	Commit   string `json:"commit"`
+	Worktree string `json:"worktree"`
+	Image    string `json:"image"`
+	Platform string `json:"platform"`
+	RunID    string `json:"runId"`
+	// Address is the host address the app is published on
+	Address   string    `json:"address"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	options Options
+	busy    bool
+}
+
+func NewPreviewManager(ctx context.Context, repos *repo.RepoManager, packBuilder *pack.PackBuilder, runManager *run.RunManager, history *history.HistoryStore, smoke *smoke.SmokeRunner) *PreviewManager {
+	return &PreviewManager{
+		ctx:         ctx,
+		repos:       repos,
+		packBuilder: packBuilder,
+		runManager:  runManager,
+		history:     history,
+		smoke:       smoke,
+		previews:    make(map[string]*Preview),
+	}
+}
+
+// Create checks a branch or pull request out into its own worktree, then
+// builds and runs it in the background. Progress is reported through
+// preview:status events.
+func (m *PreviewManager) Create(opts Options) (*Preview, error) {
+	repoPath, err := filepath.Abs(opts.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if opts.Platform != "arm64" && opts.Platform != "amd64" {
+		return nil, fmt.Errorf("invalid platform: %s", opts.Platform)
+	}
+
+	var branch, ref string
+	switch {
+	case opts.PullRequest > 0 && opts.Branch != "":
+		return nil, fmt.Errorf("choose either a branch or a pull request")
+	case opts.PullRequest > 0:
+		branch = "pr-" + strconv.Itoa(opts.PullRequest)
+		ref = fmt.Sprintf("pull/%d/head", opts.PullRequest)
+	case opts.Branch != "":
+		branch, ref = opts.Branch, opts.Branch
+	default:
+		return nil, fmt.Errorf("no branch or pull request specified")
+	}
+
+	repoName := filepath.Base(repoPath)
+	name := opts.Name
+	if name == "" {
+		name = repoName + "-" + branch
+	}
+	name = sanitize(name)
+	if name == "" {
+		return nil, fmt.Errorf("invalid preview name")
+	}
+
+	now := time.Now()
+	p := &Preview{
+		Name:      name,
+		Repo:      repoPath,
+		Branch:    branch,
+		Ref:       ref,
+		Image:     sanitize(repoName) + ":" + name,
+		Platform:  opts.Platform,
+		Status:    StatusFetching,
+		CreatedAt: now,
+		UpdatedAt: now,
+		options:   opts,
+		busy:      true,
+	}
+
+	m.mu.Lock()
+	if _, exists := m.previews[name]; exists {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("preview %s already exists", name)
+	}
+	m.previews[name] = p
+	m.mu.Unlock()
+
+	commit, err := m.repos.FetchRef(repoPath, ref)
+	if err == nil {
+		p.Worktree, err = m.repos.AddWorktree(repoPath, name, commit)
+	}
+	if err != nil {
+		m.mu.Lock()
+		delete(m.previews, name)
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	p.Commit = commit
+	c := p.snapshot()
+	m.mu.Unlock()
+
+	go m.deploy(p)
+	return c, nil
+}
+
+// Refresh moves a preview to the latest commit of its branch or pull request
+// and rebuilds it. Nothing is rebuilt when the commit hasn't changed, unless
+// the previous deploy failed.
+func (m *PreviewManager) Refresh(name string) (*Preview, error) {
+	m.mu.Lock()
+	p, ok := m.previews[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("preview not found: %s", name)
+	}
+	if p.busy {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("preview %s is already being deployed", name)
+	}
+	p.busy = true
+	repoPath, ref, worktree, current, failed := p.Repo, p.Ref, p.Worktree, p.Commit, p.Status == StatusFailed
+	m.mu.Unlock()
+
+	done := func() {
+		m.mu.Lock()
+		p.busy = false
+		m.mu.Unlock()
+	}
+
+	m.setStatus(p, StatusFetching, nil)
+	commit, err := m.repos.FetchRef(repoPath, ref)
+	if err == nil && commit != current {
+		err = m.repos.CheckoutWorktree(worktree, commit)
+	}
+	if err != nil {
+		m.setStatus(p, StatusFailed, err)
+		done()
+		return nil, err
+	}
+
+	if commit == current && !failed {
+		m.setStatus(p, StatusRunning, nil)
+		done()
+		return m.Get(name)
+	}
+
+	m.mu.Lock()
+	p.Commit = commit
+	c := p.snapshot()
+	m.mu.Unlock()
+
+	go m.deploy(p)
+	return c, nil
+}
+
+// Teardown stops a preview's run and removes its worktree and image
+func (m *PreviewManager) Teardown(name string) error {
+	m.mu.Lock()
+	p, ok := m.previews[name]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("preview not found: %s", name)
+	}
+	if p.busy {
+		m.mu.Unlock()
+		return fmt.Errorf("preview %s is being deployed, try again once it finishes", name)
+	}
+	delete(m.previews, name)
+	m.mu.Unlock()
+
+	if p.RunID != "" {
+		if err := m.runManager.Stop(p.RunID); err != nil {
+			log.Printf("Failed to stop preview run %s: %v", p.RunID, err)
+		}
+	}
+
+	if _, err := m.runManager.DockerClient().ImageRemove(m.ctx, p.Image, image.RemoveOptions{PruneChildren: true}); err != nil {
+		log.Printf("Failed to remove preview image %s: %v", p.Image, err)
+	}
+
+	if err := m.repos.RemoveWorktree(p.Repo, p.Worktree); err != nil {
+		return err
+	}
+
+	runtime.EventsEmit(m.ctx, "preview:removed", name)
+	return nil
+}
+
+// Get returns a copy of the preview with the given name
+func (m *PreviewManager) Get(name string) (*Preview, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	p, ok := m.previews[name]
+	if !ok {
+		return nil, fmt.Errorf("preview not found: %s", name)
+	}
+	return p.snapshot(), nil
+}
+
+// List returns the previews of a repo, or of every repo when repoPath is empty
+func (m *PreviewManager) List(repoPath string) []*Preview {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	previews := make([]*Preview, 0, len(m.previews))
+	for _, p := range m.previews {
+		if repoPath == "" || p.Repo == repoPath {
+			previews = append(previews, p.snapshot())
+		}
+	}
+	sort.Slice(previews, func(i, j int) bool {
+		return previews[i].Name < previews[j].Name
+	})
+	return previews
+}
+
+// deploy builds the preview's worktree and replaces its run with one of the new image
+func (m *PreviewManager) deploy(p *Preview) {
+	defer func() {
+		m.mu.Lock()
+		p.busy = false
+		m.mu.Unlock()
+	}()
+
+	m.setStatus(p, StatusBuilding, nil)
+
+	record, err := m.history.StartBuild(p.Repo, p.Image, p.Platform, p.Commit)
+	if err != nil {
+		log.Printf("Failed to record build: %v", err)
+	}
+	err = m.packBuilder.BuildWithOptions(pack.BuildOptions{
+		Path:      p.Worktree,
+		Platform:  p.Platform,
+		ImageName: p.Image,
+	})
+	if record != nil {
+		if err := m.history.FinishBuild(record.ID, err); err != nil {
+			log.Printf("Failed to record build result: %v", err)
+		}
+	}
+	if err != nil {
+		m.setStatus(p, StatusFailed, fmt.Errorf("build failed: %w", err))
+		return
+	}
+
+	m.setStatus(p, StatusStarting, nil)
+	if p.RunID != "" {
+		if err := m.runManager.Stop(p.RunID); err != nil {
+			log.Printf("Failed to stop previous preview run %s: %v", p.RunID, err)
+		}
+	}
+
+	port := p.options.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	env := map[string]string{"PORT": strconv.Itoa(port)}
+	for k, v := range p.options.Env {
+		env[k] = v
+	}
+
+	// Publishing without a host port lets docker pick a free one, so any
+	// number of previews can run side by side. The branch label gives the
+	// preview its own <repo>.<branch> hostname on the proxy.
+	r, err := m.runManager.Start(run.Options{
+		Image:  p.Image,
+		Repo:   p.Repo,
+		Branch: p.Branch,
+		Env:    env,
+		Ports:  []string{strconv.Itoa(port)},
+		Labels: map[string]string{LabelPreview: p.Name},
+	})
+	if err != nil {
+		m.mu.Lock()
+		p.RunID, p.Address = "", ""
+		m.mu.Unlock()
+		m.setStatus(p, StatusFailed, err)
+		return
+	}
+
+	address, err := m.runManager.HostPort(r.ID)
+	if err != nil {
+		log.Printf("Failed to look up preview address: %v", err)
+	}
+
+	m.mu.Lock()
+	p.RunID, p.Address = r.ID, address
+	m.mu.Unlock()
+	m.setStatus(p, StatusRunning, nil)
+
+	// Smoke checks come from the previewed commit, so a PR can change them
+	go m.smoke.RunIfDefined(r.ID, p.Worktree)
+}
+
+// setStatus updates a preview and emits it as a preview:status event
+func (m *PreviewManager) setStatus(p *Preview, status string, err error) {
+	m.mu.Lock()
+	p.Status = status
+	p.Error = ""
+	if err != nil {
+		p.Error = err.Error()
+	}
+	p.UpdatedAt = time.Now()
+	c := p.snapshot()
+	m.mu.Unlock()
+
+	runtime.EventsEmit(m.ctx, "preview:status", c)
+}
+
+func (p *Preview) snapshot() *Preview {
+	c := *p
+	return &c
+}
+
+// sanitize keeps a name usable as a directory name and an image tag
+func sanitize(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	return strings.Trim(name, "-.")
+}
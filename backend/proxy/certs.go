@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certAuthority is a locally generated CA used to sign certificates for the
+// proxy hostnames. Users trust its certificate once to get valid HTTPS for
+// every app. The CA is name constrained to the proxy suffix, so trusting it
+// doesn't let anyone mint certificates for other domains.
+type certAuthority struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certPath string
+	suffix   string
+	mu       sync.Mutex
+	leaves   map[string]*tls.Certificate
+}
+
+// loadCertAuthority reads the CA from dir, generating it on first use or
+// when the stored CA isn't constrained to suffix
+func loadCertAuthority(dir, suffix string) (*certAuthority, error) {
+	certPath := filepath.Join(dir, "proxy-ca.pem")
+	keyPath := filepath.Join(dir, "proxy-ca-key.pem")
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr != nil && !os.IsNotExist(certErr) {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+	if keyErr != nil && !os.IsNotExist(keyErr) {
+		return nil, fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	var ca *certAuthority
+	if certErr == nil && keyErr == nil {
+		var err error
+		if ca, err = parseCertAuthority(certPEM, keyPEM); err != nil {
+			return nil, err
+		}
+	}
+	if ca == nil || !slices.Equal(ca.cert.PermittedDNSDomains, []string{suffix}) {
+		var err error
+		certPEM, keyPEM, err = generateCA(suffix)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+		}
+		if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write CA key: %w", err)
+		}
+		if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write CA certificate: %w", err)
+		}
+		if ca, err = parseCertAuthority(certPEM, keyPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	ca.certPath = certPath
+	ca.suffix = suffix
+	return ca, nil
+}
+
+func parseCertAuthority(certPEM, keyPEM []byte) (*certAuthority, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type")
+	}
+
+	return &certAuthority{
+		cert:   cert,
+		key:    key,
+		leaves: make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// getCertificate issues (and caches) a certificate for the requested
+// hostname, which must be the suffix or one of its subdomains
+func (ca *certAuthority) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if host == "" {
+		host = ca.suffix
+	}
+	if host != ca.suffix && !strings.HasSuffix(host, "."+ca.suffix) {
+		return nil, fmt.Errorf("no certificate for %s outside of %s", host, ca.suffix)
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if leaf, ok := ca.leaves[host]; ok && time.Now().Before(leaf.Leaf.NotAfter) {
+		return leaf, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	leafCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	leaf := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leafCert,
+	}
+	ca.leaves[host] = leaf
+	return leaf, nil
+}
+
+func generateCA(suffix string) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{CommonName: "bskit local CA", Organization: []string{"bskit"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		// Only hostnames under the proxy suffix can be signed
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         []string{suffix},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetCertificate(t *testing.T) {
+	ca, err := loadCertAuthority(t.TempDir(), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		serverName string
+		host       string
+		wantErr    bool
+	}{
+		{serverName: "", host: "localhost"},
+		{serverName: "localhost", host: "localhost"},
+		{serverName: "api.localhost", host: "api.localhost"},
+		{serverName: "API.main.Localhost.", host: "api.main.localhost"},
+		{serverName: "example.com", wantErr: true},
+		{serverName: "evillocalhost", wantErr: true},
+		{serverName: "localhost.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			cert, err := ca.getCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got a certificate for %v", cert.Leaf.DNSNames)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: tt.host, Roots: roots}); err != nil {
+				t.Errorf("certificate doesn't verify for %s: %v", tt.host, err)
+			}
+		})
+	}
+}
+
+func TestCertAuthorityNameConstraint(t *testing.T) {
+	ca, err := loadCertAuthority(t.TempDir(), "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// A leaf signed with the CA key for another domain must not be trusted
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err == nil {
+		t.Error("expected a certificate outside the suffix to be rejected")
+	}
+}
+
+func TestLoadCertAuthority(t *testing.T) {
+	dir := t.TempDir()
+	first, err := loadCertAuthority(dir, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := loadCertAuthority(dir, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.cert.Equal(first.cert) {
+		t.Error("expected the stored CA to be reused")
+	}
+
+	other, err := loadCertAuthority(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.cert.Equal(first.cert) {
+		t.Error("expected a new CA for another suffix")
+	}
+	if !slices.Equal(other.cert.PermittedDNSDomains, []string{"test"}) {
+		t.Errorf("got name constraints %v, want [test]", other.cert.PermittedDNSDomains)
+	}
+}
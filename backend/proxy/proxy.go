@@ -0,0 +1,366 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bskit/backend/run"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Config controls where the proxy listens and which hostnames it serves
+type Config struct {
+	// HTTPAddr is the listen address for plain HTTP, empty to disable
+	HTTPAddr string `json:"httpAddr"`
+	// HTTPSAddr is the listen address for HTTPS, empty to disable
+	HTTPSAddr string `json:"httpsAddr"`
+	// Suffix is the domain appended to every hostname. *.localhost resolves
+	// to the loopback address in browsers without any DNS setup.
+	Suffix string `json:"suffix"`
+}
+
+// DefaultConfig serves <repo>.<branch>.localhost over HTTP only
+var DefaultConfig = Config{
+	HTTPAddr: "127.0.0.1:8800",
+	Suffix:   "localhost",
+}
+
+// Route maps a hostname to a bskit-managed container
+type Route struct {
+	Host   string `json:"host"`
+	URL    string `json:"url"`
+	RunID  string `json:"runId"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// Target is the host address the container port is published on
+	Target string `json:"target"`
+}
+
+// Status describes the running proxy
+type Status struct {
+	Config  Config `json:"config"`
+	Running bool   `json:"running"`
+	// CACertPath is the certificate to trust for HTTPS, when enabled
+	CACertPath string `json:"caCertPath,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type ProxyServer struct {
+	ctx        context.Context
+	runManager *run.RunManager
+	certDir    string
+	mu         sync.RWMutex
+	config     Config
+	servers    []*http.Server
+	ca         *certAuthority
+	lastErr    error
+	// routes and proxies are rebuilt when runs start or stop, rather than
+	// inspecting every container on each request
+	routesMu sync.RWMutex
+	routes   []Route
+	proxies  map[string]*httputil.ReverseProxy
+}
+
+func NewProxyServer(ctx context.Context, runManager *run.RunManager) (*ProxyServer, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	p := &ProxyServer{
+		ctx:        ctx,
+		runManager: runManager,
+		certDir:    filepath.Join(configDir, "bskit"),
+		config:     DefaultConfig,
+	}
+	for _, event := range []string{"run:started", "run:stopped", "run:exited"} {
+		runtime.EventsOn(ctx, event, func(...interface{}) {
+			p.refreshRoutes()
+		})
+	}
+	p.refreshRoutes()
+	return p, nil
+}
+
+// Start begins listening with the given configuration, replacing any
+// listeners from a previous configuration
+func (p *ProxyServer) Start(config Config) error {
+	if config.Suffix == "" {
+		config.Suffix = DefaultConfig.Suffix
+	}
+	config.Suffix = strings.Trim(strings.ToLower(config.Suffix), ".")
+
+	p.Stop()
+
+	// Hostnames and URLs depend on the configuration; deferred first so it
+	// runs after the lock is released
+	defer p.refreshRoutes()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config = config
+	p.lastErr = nil
+
+	if config.HTTPAddr != "" {
+		if err := p.listen(config.HTTPAddr, nil); err != nil {
+			p.lastErr = err
+			return err
+		}
+	}
+
+	if config.HTTPSAddr != "" {
+		if p.ca == nil || p.ca.suffix != config.Suffix {
+			ca, err := loadCertAuthority(p.certDir, config.Suffix)
+			if err != nil {
+				p.lastErr = err
+				return err
+			}
+			p.ca = ca
+		}
+		if err := p.listen(config.HTTPSAddr, &tls.Config{GetCertificate: p.ca.getCertificate}); err != nil {
+			p.lastErr = err
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop shuts down all listeners
+func (p *ProxyServer) Stop() {
+	p.mu.Lock()
+	servers := p.servers
+	p.servers = nil
+	p.mu.Unlock()
+
+	for _, srv := range servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shut down proxy listener %s: %v", srv.Addr, err)
+		}
+		cancel()
+	}
+}
+
+// GetStatus reports the configuration and state of the proxy
+func (p *ProxyServer) GetStatus() Status {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	status := Status{
+		Config:  p.config,
+		Running: len(p.servers) > 0,
+	}
+	if p.ca != nil && p.config.HTTPSAddr != "" {
+		status.CACertPath = p.ca.certPath
+	}
+	if p.lastErr != nil {
+		status.Error = p.lastErr.Error()
+	}
+	return status
+}
+
+// ListRoutes returns the hostnames currently served by the proxy. Every app
+// gets <repo>.<branch>.<suffix> when its branch is known, and the most recent
+// run of a repo also gets <repo>.<suffix>.
+func (p *ProxyServer) ListRoutes() []Route {
+	p.routesMu.RLock()
+	defer p.routesMu.RUnlock()
+
+	routes := make([]Route, len(p.routes))
+	copy(routes, p.routes)
+	return routes
+}
+
+// refreshRoutes rebuilds the routes and their reverse proxies from the
+// running apps
+func (p *ProxyServer) refreshRoutes() {
+	p.mu.RLock()
+	config := p.config
+	p.mu.RUnlock()
+
+	var routes []Route
+	seen := make(map[string]bool)
+	add := func(r *run.Run, host, target string) {
+		if seen[host] {
+			return
+		}
+		seen[host] = true
+		routes = append(routes, Route{
+			Host:   host,
+			URL:    routeURL(config, host),
+			RunID:  r.ID,
+			Repo:   r.Repo,
+			Branch: r.Options.Branch,
+			Target: target,
+		})
+	}
+
+	// Runs are listed most recent first, so the newest run wins a hostname
+	for _, r := range p.runManager.List() {
+		if r.Status != run.StatusRunning || r.Options.Labels[run.LabelService] != "" {
+			// Companion services like databases don't speak HTTP
+			continue
+		}
+		target, err := p.runManager.HostPort(r.ID)
+		if err != nil {
+			continue
+		}
+
+		name := hostLabel(repoName(r))
+		if r.Options.Branch != "" {
+			add(r, name+"."+hostLabel(r.Options.Branch)+"."+config.Suffix, target)
+		}
+		add(r, name+"."+config.Suffix, target)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Host < routes[j].Host
+	})
+
+	p.routesMu.Lock()
+	defer p.routesMu.Unlock()
+
+	// Keep the proxies of unchanged routes, along with their idle connections
+	proxies := make(map[string]*httputil.ReverseProxy, len(routes))
+	for _, route := range routes {
+		key := route.Host + "|" + route.Target
+		if proxy, ok := p.proxies[key]; ok {
+			proxies[key] = proxy
+		} else {
+			proxies[key] = newReverseProxy(route)
+		}
+	}
+	p.routes = routes
+	p.proxies = proxies
+}
+
+// newReverseProxy forwards requests to a route's container
+func newReverseProxy(route Route) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "http", Host: route.Target}
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.SetXForwarded()
+			// Keep the friendly hostname so apps generate correct links
+			r.Out.Host = r.In.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("bskit: %s is not responding: %v", route.Host, err), http.StatusBadGateway)
+		},
+	}
+}
+
+func (p *ProxyServer) listen(addr string, tlsConfig *tls.Config) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           p,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	p.servers = append(p.servers, srv)
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Proxy listener %s stopped: %v", addr, err)
+			runtime.EventsEmit(p.ctx, "proxy:error", err.Error())
+		}
+	}()
+	return nil
+}
+
+// ServeHTTP forwards a request to the container its hostname routes to
+func (p *ProxyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := strings.ToLower(req.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	p.routesMu.RLock()
+	routes := p.routes
+	var proxy *httputil.ReverseProxy
+	for _, route := range routes {
+		if route.Host == host {
+			proxy = p.proxies[route.Host+"|"+route.Target]
+			break
+		}
+	}
+	p.routesMu.RUnlock()
+
+	if proxy != nil {
+		proxy.ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintf(w, "<h1>bskit: no app for %s</h1>", html.EscapeString(host))
+	if len(routes) > 0 {
+		fmt.Fprint(w, "<p>Running apps:</p><ul>")
+		for _, route := range routes {
+			fmt.Fprintf(w, `<li><a href="%s">%s</a></li>`, html.EscapeString(route.URL), html.EscapeString(route.Host))
+		}
+		fmt.Fprint(w, "</ul>")
+	}
+}
+
+// repoName is the short name of the repo a run belongs to, falling back to
+// the image name for runs started without a repo
+func repoName(r *run.Run) string {
+	if r.Repo != "" {
+		return filepath.Base(r.Repo)
+	}
+	name := r.Image[strings.LastIndex(r.Image, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// hostLabel turns a name into a valid DNS label, e.g. feature/login -> feature-login
+func hostLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	return strings.Trim(label, "-")
+}
+
+func routeURL(config Config, host string) string {
+	scheme, addr := "http", config.HTTPAddr
+	if config.HTTPSAddr != "" {
+		scheme, addr = "https", config.HTTPSAddr
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
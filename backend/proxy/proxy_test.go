@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+
+	"bskit/backend/run"
+)
+
+func TestHostLabel(t *testing.T) {
+	tests := map[string]string{
+		"api":               "api",
+		"Feature/Login":     "feature-login",
+		"fix_bug-42":        "fix-bug-42",
+		"--release/v1.2.0-": "release-v1-2-0",
+	}
+	for name, want := range tests {
+		if got := hostLabel(name); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestRepoName(t *testing.T) {
+	tests := []struct {
+		run  *run.Run
+		want string
+	}{
+		{run: &run.Run{Repo: "/src/acme/api", Image: "ignored"}, want: "api"},
+		{run: &run.Run{Image: "registry.example.com:5000/acme/web:1.2"}, want: "web"},
+		{run: &run.Run{Image: "nginx"}, want: "nginx"},
+	}
+	for _, tt := range tests {
+		if got := repoName(tt.run); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.run, got, tt.want)
+		}
+	}
+}
+
+func TestRouteURL(t *testing.T) {
+	tests := []struct {
+		config Config
+		want   string
+	}{
+		{config: Config{HTTPAddr: "127.0.0.1:8800"}, want: "http://api.localhost:8800"},
+		{config: Config{HTTPAddr: "127.0.0.1:80"}, want: "http://api.localhost"},
+		{config: Config{HTTPAddr: "127.0.0.1:8800", HTTPSAddr: ":8443"}, want: "https://api.localhost:8443"},
+		{config: Config{HTTPSAddr: "0.0.0.0:443"}, want: "https://api.localhost"},
+	}
+	for _, tt := range tests {
+		if got := routeURL(tt.config, "api.localhost"); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+" "+r.Header.Get("X-Forwarded-Host")+" "+r.URL.Path)
+	}))
+	defer app.Close()
+
+	route := Route{Host: "api.main.localhost", URL: "http://api.main.localhost:8800", Target: strings.TrimPrefix(app.URL, "http://")}
+	p := &ProxyServer{
+		routes:  []Route{route},
+		proxies: map[string]*httputil.ReverseProxy{route.Host + "|" + route.Target: newReverseProxy(route)},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://API.main.localhost:8800/users", nil)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if got, want := rec.Body.String(), "API.main.localhost:8800 API.main.localhost:8800 /users"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://<b>.localhost:8800/", nil)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want 404", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "<b>") || !strings.Contains(body, `href="http://api.main.localhost:8800"`) {
+		t.Errorf("unexpected not found page %s", body)
+	}
+
+	app.Close()
+	req = httptest.NewRequest(http.MethodGet, "http://api.main.localhost:8800/", nil)
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("got status %d for a stopped app, want 502", rec.Code)
+	}
+}
@@ -0,0 +1,317 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// CloneOptions configures CloneRepoWithOptions. The zero value, apart from
+// URL, is a full clone of every branch.
+type CloneOptions struct {
+	URL string `json:"url"`
+	// Depth limits history to the latest commits; 0 clones all of it
+	Depth int `json:"depth"`
+	// SingleBranch only fetches the branch being checked out
+	SingleBranch bool `json:"singleBranch"`
+	// Ref is the branch or tag to check out instead of the default branch
+	Ref string `json:"ref"`
+	// SparsePaths limits the checkout to these directories
+	SparsePaths []string `json:"sparsePaths"`
+}
+
+// CloneMode records how a repository was cloned and later deepened or widened
+type CloneMode struct {
+	Depth        int      `json:"depth,omitempty"`
+	SingleBranch bool     `json:"singleBranch,omitempty"`
+	Ref          string   `json:"ref,omitempty"`
+	SparsePaths  []string `json:"sparsePaths,omitempty"`
+}
+
+// WidenOptions configures WidenRepo
+type WidenOptions struct {
+	// AllBranches fetches every branch of a single-branch clone
+	AllBranches bool `json:"allBranches"`
+	// SparsePaths are added to a sparse checkout
+	SparsePaths []string `json:"sparsePaths"`
+	// FullCheckout turns a sparse checkout into a regular one
+	FullCheckout bool `json:"fullCheckout"`
+}
+
+// DeepenRepo fetches more history for a shallow clone. A depth of 0 fetches
+// the complete history.
+func (m *RepoManager) DeepenRepo(repoPath string, depth int) error {
+	if depth < 0 {
+		return fmt.Errorf("depth must not be negative")
+	}
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if _, err := os.Stat(filepath.Join(repoPath, ".git", "shallow")); os.IsNotExist(err) {
+		if depth == 0 {
+			return nil
+		}
+		return fmt.Errorf("the repository already has its complete history")
+	}
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	url := remoteURL(repoPath)
+	auth, err := m.remoteAuth(url)
+	if err != nil {
+		return err
+	}
+
+	opts := &git.FetchOptions{RemoteName: "origin", Depth: depth, Auth: auth}
+	if depth == 0 {
+		// The depth git fetch --unshallow asks for
+		opts.Depth = math.MaxInt32
+	}
+	progress := m.newProgressWriter(m.idForPath(repoPath), "fetch")
+	opts.Progress = progress
+	if err := r.Fetch(opts); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		progress.finish("failed")
+		return fmt.Errorf("failed to deepen repository: %w", m.accessError(url, err))
+	}
+	if err := pruneShallow(repoPath, r); err != nil {
+		progress.finish("failed")
+		return fmt.Errorf("failed to update shallow commits: %w", err)
+	}
+	progress.finish("done")
+
+	return m.updateCloneMode(repoPath, func(mode *CloneMode) {
+		mode.Depth = depth
+	})
+}
+
+// WidenRepo fetches all branches of a single-branch clone and grows or
+// removes its sparse checkout
+func (m *RepoManager) WidenRepo(repoPath string, opts WidenOptions) error {
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	info, err := m.RepoForPath(repoPath)
+	if err != nil {
+		return err
+	}
+	sparsePaths, err := cleanSparsePaths(opts.SparsePaths)
+	if err != nil {
+		return err
+	}
+	if len(sparsePaths) > 0 && !opts.FullCheckout && len(info.Clone.SparsePaths) == 0 {
+		return fmt.Errorf("%s is not a sparse checkout", info.ID)
+	}
+
+	if opts.AllBranches {
+		r, err := git.PlainOpen(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to open repository: %w", err)
+		}
+		auth, err := m.remoteAuth(info.RemoteURL)
+		if err != nil {
+			return err
+		}
+		progress := m.newProgressWriter(info.ID, "fetch")
+		err = fetchBranches(context.Background(), r, &git.FetchOptions{
+			Depth:    shallowDepth(r, info.Clone),
+			Auth:     auth,
+			Progress: progress,
+		})
+		if err != nil {
+			progress.finish("failed")
+			return fmt.Errorf("failed to fetch all branches: %w", m.accessError(info.RemoteURL, err))
+		}
+		progress.finish("done")
+	}
+
+	switch {
+	case opts.FullCheckout:
+		if _, err := runGit(repoPath, "sparse-checkout", "disable"); err != nil {
+			return fmt.Errorf("failed to disable sparse checkout: %w", err)
+		}
+	case len(sparsePaths) > 0:
+		args := append([]string{"sparse-checkout", "add", "--"}, sparsePaths...)
+		if _, err := runGit(repoPath, args...); err != nil {
+			return fmt.Errorf("failed to widen sparse checkout: %w", err)
+		}
+	}
+
+	return m.updateCloneMode(repoPath, func(mode *CloneMode) {
+		if opts.AllBranches {
+			mode.SingleBranch = false
+		}
+		if opts.FullCheckout {
+			mode.SparsePaths = nil
+		} else if len(sparsePaths) > 0 {
+			mode.SparsePaths, _ = cleanSparsePaths(append(mode.SparsePaths, sparsePaths...))
+		}
+	})
+}
+
+// resolveRemoteRef turns a branch or tag name, or a ref such as
+// pull/42/head, into the full reference name on the remote
+func (m *RepoManager) resolveRemoteRef(ctx context.Context, url, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote refs: %w", m.accessError(url, err))
+	}
+
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(ref),
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+		plumbing.ReferenceName("refs/" + ref),
+	}
+	for _, candidate := range candidates {
+		for _, r := range refs {
+			if r.Name() == candidate {
+				return candidate, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("%s is not a branch or tag of %s", ref, url)
+}
+
+// fetchBranches makes origin track every branch and fetches them, to widen a
+// single-branch clone or after cloning at a tag, since go-git then only
+// fetches the tag itself
+func fetchBranches(ctx context.Context, r *git.Repository, opts *git.FetchOptions) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	remote, ok := cfg.Remotes["origin"]
+	if !ok {
+		return fmt.Errorf("origin remote is missing")
+	}
+	refSpec := config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, "origin"))
+	remote.Fetch = []config.RefSpec{refSpec}
+	if err := r.SetConfig(cfg); err != nil {
+		return err
+	}
+
+	opts.RemoteName = "origin"
+	opts.RefSpecs = []config.RefSpec{refSpec}
+	err = r.FetchContext(ctx, opts)
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+	return nil
+}
+
+// shallowDepth is the depth to fetch with so a shallow clone stays shallow.
+// go-git only tells the server which commits are shallow when fetching with
+// a depth, so one is always set for shallow clones.
+func shallowDepth(r *git.Repository, mode CloneMode) int {
+	if shallow, _ := r.Storer.Shallow(); len(shallow) == 0 {
+		return 0
+	}
+	if mode.Depth > 0 {
+		return mode.Depth
+	}
+	return 1
+}
+
+// pruneShallow forgets shallow commits whose parents have been fetched.
+// go-git only ever adds to the shallow list, so deepened history would
+// otherwise still look cut off to git.
+func pruneShallow(repoPath string, r *git.Repository) error {
+	shallow, err := r.Storer.Shallow()
+	if err != nil || len(shallow) == 0 {
+		return err
+	}
+
+	var kept []plumbing.Hash
+	for _, hash := range shallow {
+		commit, err := r.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			if r.Storer.HasEncodedObject(parent) != nil {
+				kept = append(kept, hash)
+				break
+			}
+		}
+	}
+	if len(kept) == 0 {
+		// Like git, drop the file once the history is complete
+		return os.Remove(filepath.Join(repoPath, ".git", "shallow"))
+	}
+	return r.Storer.SetShallow(kept)
+}
+
+// sparseCheckout populates a clone made without checkout with only the given
+// directories. go-git can't change a sparse checkout later, so git does it.
+func sparseCheckout(repoPath string, paths []string) error {
+	// go-git leaves the format version out of the config, and without it git
+	// ignores the worktree config where sparse checkout is enabled
+	if _, err := runGit(repoPath, "config", "core.repositoryformatversion", "0"); err != nil {
+		return fmt.Errorf("failed to configure repository: %w", err)
+	}
+	args := append([]string{"sparse-checkout", "set", "--cone", "--"}, paths...)
+	if _, err := runGit(repoPath, args...); err != nil {
+		return fmt.Errorf("failed to configure sparse checkout: %w", err)
+	}
+	if _, err := runGit(repoPath, "read-tree", "-mu", "HEAD"); err != nil {
+		return fmt.Errorf("failed to check out sparse paths: %w", err)
+	}
+	return nil
+}
+
+// cleanSparsePaths normalizes sparse checkout directories to sorted, unique,
+// slash separated paths inside the repository
+func cleanSparsePaths(paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var cleaned []string
+	for _, p := range paths {
+		p = strings.TrimSpace(filepath.ToSlash(p))
+		if p == "" {
+			continue
+		}
+		p = strings.Trim(path.Clean(p), "/")
+		if p == "" || p == "." || p == ".." || strings.HasPrefix(p, "../") || filepath.IsAbs(p) {
+			return nil, fmt.Errorf("invalid sparse checkout path: %s", p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			cleaned = append(cleaned, p)
+		}
+	}
+	sort.Strings(cleaned)
+	return cleaned, nil
+}
+
+// updateCloneMode changes the recorded clone mode of a registered repository
+func (m *RepoManager) updateCloneMode(repoPath string, update func(mode *CloneMode)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := m.findByPath(repoPath)
+	if info == nil {
+		return nil
+	}
+	update(&info.Clone)
+	return m.saveIndex()
+}
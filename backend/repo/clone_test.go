@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCleanSparsePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", paths: nil, want: nil},
+		{name: "blank entries", paths: []string{"", "  "}, want: nil},
+		{name: "sorted", paths: []string{"web", "api"}, want: []string{"api", "web"}},
+		{name: "trimmed", paths: []string{" api/ ", "/web"}, want: []string{"api", "web"}},
+		{name: "cleaned", paths: []string{"api/./src/../lib"}, want: []string{"api/lib"}},
+		{name: "deduplicated", paths: []string{"api", "api/", "./api"}, want: []string{"api"}},
+		{name: "current directory", paths: []string{"."}, wantErr: true},
+		{name: "parent directory", paths: []string{".."}, wantErr: true},
+		{name: "escapes repo", paths: []string{"api/../../etc"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanSparsePaths(tt.paths)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
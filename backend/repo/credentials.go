@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// TokenProvider returns the OAuth token and its comma separated scopes for a
+// git host, or an empty token when the user isn't signed in to it
+type TokenProvider func(host string) (token, scopes string)
+
+// SetTokenProvider sets where tokens for HTTPS git operations come from
+func (m *RepoManager) SetTokenProvider(provider TokenProvider) {
+	m.tokensMu.Lock()
+	defer m.tokensMu.Unlock()
+	m.tokens = provider
+}
+
+// authFor returns the credentials go-git should use for a remote, or nil to
+// access it anonymously. Callers must hold mu.
+func (m *RepoManager) authFor(remoteURL string) (transport.AuthMethod, error) {
+	if isSSHURL(remoteURL) {
+		return m.sshAuth(remoteURL, m.settings.SSHKeyPath)
+	}
+
+	token, _ := m.token(remoteURL)
+	if token == "" {
+		return nil, nil
+	}
+	// GitHub accepts OAuth tokens as the password for any non-empty username
+	return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+}
+
+func (m *RepoManager) token(remoteURL string) (token, scopes string) {
+	if !strings.HasPrefix(remoteURL, "https://") {
+		return "", ""
+	}
+	host, _, _, err := ParseRepoURL(remoteURL)
+	if err != nil {
+		return "", ""
+	}
+
+	m.tokensMu.RLock()
+	provider := m.tokens
+	m.tokensMu.RUnlock()
+	if provider == nil {
+		return "", ""
+	}
+	return provider(host)
+}
+
+// accessError explains why a remote refused access. GitHub answers "not
+// found" for private repos the token can't see, so that is treated the same.
+func (m *RepoManager) accessError(remoteURL string, err error) error {
+	if !errors.Is(err, transport.ErrAuthenticationRequired) &&
+		!errors.Is(err, transport.ErrAuthorizationFailed) &&
+		!errors.Is(err, transport.ErrRepositoryNotFound) {
+		return err
+	}
+
+	token, scopes := m.token(remoteURL)
+	switch {
+	case isSSHURL(remoteURL):
+		return fmt.Errorf("the SSH server refused access to %s, check that your key is added to your account: %w", remoteURL, err)
+	case !strings.HasPrefix(remoteURL, "https://"):
+		return fmt.Errorf("access to %s was denied: %w", remoteURL, err)
+	case token == "":
+		return fmt.Errorf("%s is private or does not exist, sign in with GitHub to clone private repositories: %w", remoteURL, err)
+	case !hasScope(scopes, "repo"):
+		return fmt.Errorf("your GitHub sign-in does not include access to private repositories, sign in again to grant it: %w", err)
+	}
+	return fmt.Errorf("your GitHub account has no access to %s, or it does not exist: %w", remoteURL, err)
+}
+
+func hasScope(scopes, scope string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		if strings.TrimSpace(s) == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,129 +1,336 @@
 package repo
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 )
 
 type RepoManager struct {
-	baseDir  string
+	// reposDir is the workspace all repositories are cloned into
 	reposDir string
 	mu       sync.RWMutex
+	index    *repoIndex
+	settings Settings
+	// clones holds the cancel funcs of clones in progress, keyed by repo ID
+	clones map[string]context.CancelFunc
+	// moving is set while the workspace is moved to another directory
+	moving bool
+	// ops counts repository operations running without mu, which keep the
+	// workspace from being moved
+	ops int
+	// busyWorktrees holds the paths of worktrees being created, removed or
+	// used by a build
+	busyWorktrees map[string]bool
+	// The app context and the credentials have their own locks since they
+	// are consulted while mu is held
+	ctxMu         sync.RWMutex
+	ctx           context.Context
+	tokensMu      sync.RWMutex
+	tokens        TokenProvider
+	hostKeyPrompt HostKeyPrompt
+	passphrase    string
 }
 
 type RepoStatus struct {
 	IsCloned bool   `json:"isCloned"`
 	Path     string `json:"path"`
+	// Repo is the registry entry of a cloned repository
+	Repo *RepoInfo `json:"repo,omitempty"`
+
+	// Branch is empty when HEAD is detached
+	Branch string      `json:"branch"`
+	Head   *CommitInfo `json:"head,omitempty"`
+	// Modified counts tracked files with staged or unstaged changes
+	Modified  int  `json:"modified"`
+	Untracked int  `json:"untracked"`
+	Dirty     bool `json:"dirty"`
+	// Upstream is the tracked remote branch, e.g. origin/main, if any
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	// BuildMatchesHead is true when the last build was of HEAD with a clean working tree
+	BuildMatchesHead bool `json:"buildMatchesHead"`
+	// StatusError explains why the working tree status is missing
+	StatusError string `json:"statusError,omitempty"`
 }
 
+// NewRepoManager opens the workspace, moving repos cloned next to the
+// executable by older versions into it
 func NewRepoManager() (*RepoManager, error) {
-	execPath, err := os.Executable()
+	settings, err := loadSettings()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get executable path: %w", err)
+		return nil, err
 	}
 
-	baseDir := filepath.Dir(execPath)
-	reposDir := filepath.Join(baseDir, "repos")
+	reposDir, err := workspaceDir(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateLegacyWorkspace(reposDir); err != nil {
+		// The move was rolled back, so keep using the old location; it is
+		// retried on the next start
+		log.Printf("Failed to move repositories to %s: %v", reposDir, err)
+		reposDir = legacyWorkspaceDir()
+	}
 
 	if err := os.MkdirAll(reposDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create repos directory: %w", err)
 	}
 
-	return &RepoManager{
-		baseDir:  baseDir,
-		reposDir: reposDir,
-	}, nil
+	m := &RepoManager{
+		reposDir:      reposDir,
+		settings:      settings,
+		clones:        make(map[string]context.CancelFunc),
+		busyWorktrees: make(map[string]bool),
+	}
+	if err := m.loadIndex(); err != nil {
+		return nil, err
+	}
+	m.cleanupWorktrees()
+	return m, nil
+}
+
+// SetContext sets the app context used to emit repo:progress events
+func (m *RepoManager) SetContext(ctx context.Context) {
+	m.ctxMu.Lock()
+	defer m.ctxMu.Unlock()
+	m.ctx = ctx
 }
 
-// CloneRepo clones a repository and returns its local path
+// CloneRepo clones a repository into repos/<host>/<owner>/<name>, registers
+// it and returns its local path. Progress is reported with repo:progress
+// events and the clone can be stopped with CancelClone.
 func (m *RepoManager) CloneRepo(url string) (string, error) {
+	return m.CloneRepoWithOptions(CloneOptions{URL: url})
+}
+
+// CloneRepoWithOptions clones a repository, optionally shallow, limited to
+// one branch or ref, or with a sparse checkout
+func (m *RepoManager) CloneRepoWithOptions(opts CloneOptions) (string, error) {
+	url := opts.URL
+	if opts.Depth < 0 {
+		return "", fmt.Errorf("clone depth must not be negative")
+	}
+	sparsePaths, err := cleanSparsePaths(opts.SparsePaths)
+	if err != nil {
+		return "", err
+	}
+
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	host, owner, name, err := ParseRepoURL(url)
+	if err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
+	id := repoID(host, owner, name)
+	if existing, ok := m.index.Repos[id]; ok {
+		if _, err := git.PlainOpen(existing.Path); err == nil {
+			m.mu.Unlock()
+			return "", fmt.Errorf("%s is already cloned at %s", id, existing.Path)
+		}
+	}
+	if _, ok := m.clones[id]; ok {
+		m.mu.Unlock()
+		return "", fmt.Errorf("%s is already being cloned", id)
+	}
+	if err := m.checkNotMoving(); err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
 
-	// Extract repo name from URL
-	repoName := filepath.Base(url)
-	if repoName == "" {
-		return "", fmt.Errorf("invalid repository URL")
+	auth, err := m.authFor(url)
+	if err != nil {
+		m.mu.Unlock()
+		return "", err
 	}
 
+	// The clone runs without holding mu so other repos stay usable meanwhile
+	ctx, cancel := context.WithCancel(context.Background())
+	m.clones[id] = cancel
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.clones, id)
+		m.mu.Unlock()
+		cancel()
+	}()
+
 	// Create repo directory
-	repoPath := filepath.Join(m.reposDir, repoName)
+	repoPath := filepath.Join(m.reposDir, host, filepath.FromSlash(owner), name)
 	if err := os.MkdirAll(repoPath, 0755); err != nil {
 		return "", fmt.Errorf("failed to create repo directory: %w", err)
 	}
 
 	// Clone the repository
-	_, err := git.PlainClone(repoPath, false, &git.CloneOptions{
-		URL:      url,
-		Progress: os.Stdout,
-	})
+	progress := m.newProgressWriter(id, "clone")
+	cloneOpts := &git.CloneOptions{
+		URL:          url,
+		Auth:         auth,
+		Progress:     progress,
+		Depth:        opts.Depth,
+		SingleBranch: opts.SingleBranch,
+		// Sparse checkouts are populated below, once git knows which paths to keep
+		NoCheckout: len(sparsePaths) > 0,
+	}
+	if opts.Ref != "" {
+		cloneOpts.ReferenceName, err = m.resolveRemoteRef(ctx, url, opts.Ref, auth)
+		if err != nil {
+			os.RemoveAll(repoPath)
+			progress.finish("failed")
+			return "", err
+		}
+	}
+	r, err := git.PlainCloneContext(ctx, repoPath, false, cloneOpts)
+	if err == nil && cloneOpts.ReferenceName.IsTag() && !opts.SingleBranch {
+		err = fetchBranches(ctx, r, &git.FetchOptions{
+			Depth:    cloneOpts.Depth,
+			Auth:     cloneOpts.Auth,
+			Progress: cloneOpts.Progress,
+		})
+	}
+	if err == nil && len(sparsePaths) > 0 {
+		err = sparseCheckout(repoPath, sparsePaths)
+	}
 	if err != nil {
 		// Clean up the directory if clone fails
 		os.RemoveAll(repoPath)
-		return "", fmt.Errorf("failed to clone repository: %w", err)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			progress.finish("cancelled")
+			return "", fmt.Errorf("clone of %s was cancelled", id)
+		}
+		progress.finish("failed")
+		return "", fmt.Errorf("failed to clone repository: %w", m.accessError(url, err))
+	}
+
+	info := &RepoInfo{
+		ID:        id,
+		Host:      host,
+		Owner:     owner,
+		Name:      name,
+		Path:      repoPath,
+		RemoteURL: url,
+		ClonedAt:  time.Now(),
+		Clone: CloneMode{
+			Depth:        opts.Depth,
+			SingleBranch: opts.SingleBranch,
+			Ref:          opts.Ref,
+			SparsePaths:  sparsePaths,
+		},
+	}
+	if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+		info.DefaultBranch = head.Name().Short()
 	}
 
+	m.mu.Lock()
+	err = m.register(info)
+	m.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	progress.finish("done")
 	return repoPath, nil
 }
 
-// GetRepoStatus checks if a repository is already cloned
-func (m *RepoManager) GetRepoStatus(url string) (*RepoStatus, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// CancelClone stops a clone in progress, given its URL or repo ID. The
+// partial checkout is removed.
+func (m *RepoManager) CancelClone(urlOrID string) error {
+	id := urlOrID
+	if host, owner, name, err := ParseRepoURL(urlOrID); err == nil {
+		id = repoID(host, owner, name)
+	}
 
-	repoName := filepath.Base(url)
-	if repoName == "" {
-		return nil, fmt.Errorf("invalid repository URL")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cancel, ok := m.clones[id]
+	if !ok {
+		return fmt.Errorf("no clone in progress for %s", urlOrID)
 	}
+	cancel()
+	return nil
+}
 
-	repoPath := filepath.Join(m.reposDir, repoName)
+// GetRepoStatus checks if a repository is already cloned and, if so,
+// reports the state of its working tree. The repository is given by its
+// URL, or by the ID or path of a registered repository, which is the only
+// way to address local checkouts without a remote.
+func (m *RepoManager) GetRepoStatus(urlOrID string) (*RepoStatus, error) {
+	m.mu.RLock()
+	info := m.lookup(urlOrID)
+	if info == nil {
+		defer m.mu.RUnlock()
+		host, owner, name, err := ParseRepoURL(urlOrID)
+		if err != nil {
+			return nil, fmt.Errorf("repository not found: %s", urlOrID)
+		}
+		return &RepoStatus{
+			IsCloned: false,
+			Path:     filepath.Join(m.reposDir, host, filepath.FromSlash(owner), name),
+		}, nil
+	}
+	info = info.copy()
+	m.mu.RUnlock()
 
 	// Check if directory exists and is a git repository
-	_, err := git.PlainOpen(repoPath)
+	_, err := git.PlainOpen(info.Path)
 	if err != nil {
 		if err == git.ErrRepositoryNotExists {
 			return &RepoStatus{
 				IsCloned: false,
-				Path:     repoPath,
+				Path:     info.Path,
 			}, nil
 		}
 		return nil, fmt.Errorf("failed to check repository status: %w", err)
 	}
 
-	return &RepoStatus{
+	status := &RepoStatus{
 		IsCloned: true,
-		Path:     repoPath,
-	}, nil
+		Path:     info.Path,
+		Repo:     info,
+	}
+	workingTreeStatus(status)
+	return status, nil
 }
 
-// ListClonedRepos returns a list of all cloned repositories
+// ListClonedRepos returns the paths of all cloned repositories
 func (m *RepoManager) ListClonedRepos() ([]string, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	entries, err := os.ReadDir(m.reposDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read repos directory: %w", err)
+	var repos []string
+	for _, info := range m.ListRepos() {
+		repos = append(repos, info.Path)
 	}
+	return repos, nil
+}
 
-	var repos []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
+// DeleteRepo deletes a cloned repository and removes it from the registry.
+// Imported local checkouts are only unregistered, their files are kept.
+func (m *RepoManager) DeleteRepo(repoPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		repoPath := filepath.Join(m.reposDir, entry.Name())
-		_, err := git.PlainOpen(repoPath)
-		if err == nil {
-			repos = append(repos, repoPath)
+	if err := m.checkNotMoving(); err != nil {
+		return err
+	}
+	info := m.findByPath(repoPath)
+	if info == nil || !info.Local {
+		if err := DeleteRepo(repoPath); err != nil {
+			return err
 		}
 	}
-
-	return repos, nil
+	if info != nil {
+		delete(m.index.Repos, info.ID)
+		return m.saveIndex()
+	}
+	return nil
 }
 
 // Add detailed logging around the os.RemoveAll call to debug deletion issues
@@ -153,3 +360,17 @@ func DeleteRepo(repoPath string) error {
 
 	return nil
 }
+
+// HeadCommit returns the commit hash checked out at path, or an empty string
+// when path is not inside a git repository
+func HeadCommit(path string) string {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := r.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
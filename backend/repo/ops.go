@@ -0,0 +1,440 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Branch is a local branch or a branch of the origin remote
+type Branch struct {
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+	// Remote is true for origin branches that have no local branch yet
+	Remote  bool `json:"remote"`
+	Current bool `json:"current"`
+}
+
+// Tag is a git tag and the commit it points to
+type Tag struct {
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+}
+
+// FetchRepo fetches all branches and tags from origin without touching the
+// working tree
+func (m *RepoManager) FetchRepo(repoPath string) error {
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	url := remoteURL(repoPath)
+	auth, err := m.remoteAuth(url)
+	if err != nil {
+		return err
+	}
+
+	progress := m.newProgressWriter(m.idForPath(repoPath), "fetch")
+	err = r.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		Auth:       auth,
+		Progress:   progress,
+		Tags:       git.AllTags,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		progress.finish("failed")
+		return fmt.Errorf("failed to fetch: %w", m.accessError(url, err))
+	}
+	progress.finish("done")
+	return nil
+}
+
+// PullRepo fast-forwards the current branch to its origin counterpart.
+// Diverged branches and uncommitted changes are reported as errors rather
+// than merged or overwritten.
+func (m *RepoManager) PullRepo(repoPath string) error {
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if m.isSparse(repoPath) {
+		return m.pullSparse(repoPath)
+	}
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return fmt.Errorf("HEAD is detached, check out a branch to pull")
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open working tree: %w", err)
+	}
+	if err := checkClean(w); err != nil {
+		return err
+	}
+
+	url := remoteURL(repoPath)
+	auth, err := m.remoteAuth(url)
+	if err != nil {
+		return err
+	}
+
+	progress := m.newProgressWriter(m.idForPath(repoPath), "fetch")
+	err = w.Pull(&git.PullOptions{
+		RemoteName:    "origin",
+		ReferenceName: head.Name(),
+		SingleBranch:  true,
+		Auth:          auth,
+		Progress:      progress,
+	})
+	switch {
+	case err == nil, errors.Is(err, git.NoErrAlreadyUpToDate):
+		progress.finish("done")
+		return nil
+	case errors.Is(err, git.ErrNonFastForwardUpdate):
+		progress.finish("failed")
+		return fmt.Errorf("%s has diverged from origin and can't be fast-forwarded", head.Name().Short())
+	case errors.Is(err, transport.ErrEmptyRemoteRepository), errors.Is(err, plumbing.ErrReferenceNotFound):
+		progress.finish("failed")
+		return fmt.Errorf("branch %s does not exist on origin", head.Name().Short())
+	}
+	progress.finish("failed")
+	return fmt.Errorf("failed to pull: %w", m.accessError(url, err))
+}
+
+// pullSparse is PullRepo for sparse checkouts. go-git would check out every
+// file, so it only fetches and git fast-forwards the working tree.
+func (m *RepoManager) pullSparse(repoPath string) error {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return fmt.Errorf("HEAD is detached, check out a branch to pull")
+	}
+	if err := checkCleanGit(repoPath); err != nil {
+		return err
+	}
+
+	url := remoteURL(repoPath)
+	auth, err := m.remoteAuth(url)
+	if err != nil {
+		return err
+	}
+	var mode CloneMode
+	if info, err := m.RepoForPath(repoPath); err == nil {
+		mode = info.Clone
+	}
+
+	branch := head.Name().Short()
+	remoteRef := plumbing.NewRemoteReferenceName("origin", branch)
+	progress := m.newProgressWriter(m.idForPath(repoPath), "fetch")
+	err = r.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", head.Name(), remoteRef))},
+		Depth:      shallowDepth(r, mode),
+		Auth:       auth,
+		Progress:   progress,
+	})
+	switch {
+	case err == nil, errors.Is(err, git.NoErrAlreadyUpToDate):
+	case errors.Is(err, git.NoMatchingRefSpecError{}):
+		progress.finish("failed")
+		return fmt.Errorf("branch %s does not exist on origin", branch)
+	default:
+		progress.finish("failed")
+		return fmt.Errorf("failed to pull: %w", m.accessError(url, err))
+	}
+
+	remote, err := r.Reference(remoteRef, true)
+	if err != nil {
+		progress.finish("failed")
+		return fmt.Errorf("branch %s does not exist on origin", branch)
+	}
+	if remote.Hash() != head.Hash() {
+		if _, err := runGit(repoPath, "merge", "--ff-only", "--quiet", remoteRef.String()); err != nil {
+			progress.finish("failed")
+			return fmt.Errorf("%s has diverged from origin and can't be fast-forwarded: %w", branch, err)
+		}
+	}
+	progress.finish("done")
+	return nil
+}
+
+// ListBranches returns the local branches followed by origin branches that
+// haven't been checked out yet
+func (m *RepoManager) ListBranches(repoPath string) ([]Branch, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	var current plumbing.ReferenceName
+	if head, err := r.Head(); err == nil {
+		current = head.Name()
+	}
+
+	refs, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+	local := make(map[string]bool)
+	var branches, remote []Branch
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		switch {
+		case name.IsBranch():
+			local[name.Short()] = true
+			branches = append(branches, Branch{
+				Name:    name.Short(),
+				Commit:  ref.Hash().String(),
+				Current: name == current,
+			})
+		case name.IsRemote() && strings.HasPrefix(name.String(), "refs/remotes/origin/"):
+			short := strings.TrimPrefix(name.String(), "refs/remotes/origin/")
+			if short == "HEAD" || ref.Type() != plumbing.HashReference {
+				return nil
+			}
+			remote = append(remote, Branch{Name: short, Commit: ref.Hash().String(), Remote: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	sort.Slice(branches, func(i, j int) bool {
+		return branches[i].Name < branches[j].Name
+	})
+	sort.Slice(remote, func(i, j int) bool {
+		return remote[i].Name < remote[j].Name
+	})
+	for _, b := range remote {
+		if !local[b.Name] {
+			branches = append(branches, b)
+		}
+	}
+	return branches, nil
+}
+
+// ListTags returns the tags of the repository, sorted by name
+func (m *RepoManager) ListTags(repoPath string) ([]Tag, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	refs, err := r.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	var tags []Tag
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		tags = append(tags, Tag{Name: ref.Name().Short(), Commit: tagCommit(r, ref).String()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// Checkout switches the working tree to a branch, tag or commit SHA. Origin
+// branches get a local tracking branch; tags and commits detach HEAD.
+func (m *RepoManager) Checkout(repoPath, ref string) error {
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open working tree: %w", err)
+	}
+	sparse := m.isSparse(repoPath)
+	if sparse {
+		err = checkCleanGit(repoPath)
+	} else {
+		err = checkClean(w)
+	}
+	if err != nil {
+		return err
+	}
+
+	opts, err := checkoutOptions(r, ref)
+	if err != nil {
+		return err
+	}
+	if sparse {
+		// go-git's sparse checkouts don't match git's cone mode, so git
+		// switches the working tree within the sparse paths
+		err = checkoutGit(repoPath, opts)
+	} else {
+		err = w.Checkout(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+
+	// New local branches follow their origin branch so they can be pulled
+	if opts.Create {
+		err := r.CreateBranch(&config.Branch{
+			Name:   ref,
+			Remote: "origin",
+			Merge:  plumbing.NewBranchReferenceName(ref),
+		})
+		if err != nil && !errors.Is(err, git.ErrBranchExists) {
+			return fmt.Errorf("failed to track origin/%s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// checkoutGit runs the git checkout equivalent to opts
+func checkoutGit(repoPath string, opts *git.CheckoutOptions) error {
+	var args []string
+	switch {
+	case opts.Create:
+		args = []string{"checkout", "--quiet", "-b", opts.Branch.Short(), opts.Hash.String()}
+	case opts.Branch != "":
+		args = []string{"checkout", "--quiet", opts.Branch.Short()}
+	default:
+		args = []string{"checkout", "--quiet", "--detach", opts.Hash.String()}
+	}
+	_, err := runGit(repoPath, args...)
+	return err
+}
+
+// checkoutOptions resolves ref, in order, as a local branch, an origin
+// branch, a tag and finally any revision git understands
+func checkoutOptions(r *git.Repository, ref string) (*git.CheckoutOptions, error) {
+	branch := plumbing.NewBranchReferenceName(ref)
+	if _, err := r.Reference(branch, false); err == nil {
+		return &git.CheckoutOptions{Branch: branch}, nil
+	}
+	if remote, err := r.Reference(plumbing.NewRemoteReferenceName("origin", ref), true); err == nil {
+		return &git.CheckoutOptions{Branch: branch, Hash: remote.Hash(), Create: true}, nil
+	}
+	if tag, err := r.Tag(ref); err == nil {
+		return &git.CheckoutOptions{Hash: tagCommit(r, tag)}, nil
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a branch, tag or commit", ref)
+	}
+	return &git.CheckoutOptions{Hash: *hash}, nil
+}
+
+// tagCommit returns the commit a tag points to, peeling annotated tags
+func tagCommit(r *git.Repository, ref *plumbing.Reference) plumbing.Hash {
+	if tag, err := r.TagObject(ref.Hash()); err == nil {
+		if commit, err := tag.Commit(); err == nil {
+			return commit.Hash
+		}
+	}
+	return ref.Hash()
+}
+
+// checkClean fails when tracked files have uncommitted changes. Untracked
+// files are left alone, like git itself does.
+func checkClean(w *git.Worktree) error {
+	status, err := w.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read working tree status: %w", err)
+	}
+
+	var dirty []string
+	for path, s := range status {
+		if s.Worktree == git.Untracked && s.Staging == git.Untracked {
+			continue
+		}
+		if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			dirty = append(dirty, path)
+		}
+	}
+	return dirtyError(dirty)
+}
+
+// checkCleanGit is checkClean for sparse checkouts, asking git for the status
+func checkCleanGit(repoPath string) error {
+	out, err := runGit(repoPath, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return fmt.Errorf("failed to read working tree status: %w", err)
+	}
+	var dirty []string
+	for _, line := range strings.Split(out, "\n") {
+		// e.g. " M path/to/file", the status codes come first
+		if _, path, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			dirty = append(dirty, strings.TrimSpace(path))
+		}
+	}
+	return dirtyError(dirty)
+}
+
+func dirtyError(dirty []string) error {
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	sort.Strings(dirty)
+	if len(dirty) > 3 {
+		dirty = append(dirty[:3], fmt.Sprintf("and %d more", len(dirty)-3))
+	}
+	return fmt.Errorf("the working tree has uncommitted changes, commit or discard them first: %s", strings.Join(dirty, ", "))
+}
+
+// isSparse reports whether a registered repository was cloned with a sparse checkout
+func (m *RepoManager) isSparse(repoPath string) bool {
+	info, err := m.RepoForPath(repoPath)
+	return err == nil && len(info.Clone.SparsePaths) > 0
+}
+
+// remoteAuth returns the credentials for a remote, for callers not holding mu
+func (m *RepoManager) remoteAuth(remoteURL string) (transport.AuthMethod, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.authFor(remoteURL)
+}
+
+// idForPath returns the repo ID of a checkout, or the path when it isn't registered
+func (m *RepoManager) idForPath(repoPath string) string {
+	if info, err := m.RepoForPath(repoPath); err == nil {
+		return info.ID
+	}
+	return repoPath
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// progressInterval limits how often repo:progress is emitted within a phase
+const progressInterval = 100 * time.Millisecond
+
+// Progress is the state of a clone or fetch, as reported by the git server
+type Progress struct {
+	// RepoID is the registry key of the repository, host/owner/name
+	RepoID string `json:"repoId"`
+	// Operation is clone, fetch or move, when the workspace is moved
+	Operation string `json:"operation"`
+	// Phase is the server's phase, e.g. "Receiving objects", or done
+	Phase   string `json:"phase"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total"`
+	Percent int    `json:"percent"`
+	// Bytes received so far, only known while receiving objects
+	Bytes int64 `json:"bytes"`
+}
+
+var (
+	// e.g. "Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s"
+	percentLine = regexp.MustCompile(`^([A-Za-z ]+):\s+(\d+)% \((\d+)/(\d+)\)(?:,\s+([0-9.]+) ([KMG]i)?B)?`)
+	// e.g. "Enumerating objects: 20, done."
+	countLine = regexp.MustCompile(`^([A-Za-z ]+):\s+(\d+)(?:,|$)`)
+)
+
+// progressWriter turns git sideband output into repo:progress events
+type progressWriter struct {
+	m        *RepoManager
+	mu       sync.Mutex
+	progress Progress
+	buf      []byte
+	lastEmit time.Time
+}
+
+func (m *RepoManager) newProgressWriter(repoID, operation string) *progressWriter {
+	return &progressWriter{
+		m:        m,
+		progress: Progress{RepoID: repoID, Operation: operation},
+	}
+}
+
+// Write parses complete lines; git separates updates with \r and phases with \n
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.parse(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *progressWriter) parse(line string) {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "remote:"))
+	if line == "" {
+		return
+	}
+
+	next := w.progress
+	if match := percentLine.FindStringSubmatch(line); match != nil {
+		next.Phase = strings.TrimSpace(match[1])
+		next.Percent, _ = strconv.Atoi(match[2])
+		next.Current, _ = strconv.ParseInt(match[3], 10, 64)
+		next.Total, _ = strconv.ParseInt(match[4], 10, 64)
+		if match[5] != "" {
+			next.Bytes = parseSize(match[5], match[6])
+		}
+	} else if match := countLine.FindStringSubmatch(line); match != nil {
+		next.Phase = strings.TrimSpace(match[1])
+		next.Current, _ = strconv.ParseInt(match[2], 10, 64)
+		next.Total, next.Percent = 0, 0
+	} else {
+		return
+	}
+
+	// Always report phase changes and completion, throttle the rest
+	force := next.Phase != w.progress.Phase || next.Percent == 100
+	w.progress = next
+	if force || time.Since(w.lastEmit) >= progressInterval {
+		w.emit()
+	}
+}
+
+// finish reports the final phase, e.g. done, cancelled or failed
+func (w *progressWriter) finish(phase string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.progress.Phase = phase
+	if phase == "done" {
+		w.progress.Percent = 100
+	}
+	w.emit()
+}
+
+func (w *progressWriter) emit() {
+	w.lastEmit = time.Now()
+	w.m.emit("repo:progress", w.progress)
+}
+
+// parseSize converts a git size such as "1.20 MiB" to bytes
+func parseSize(value, unit string) int64 {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "Ki":
+		n *= 1 << 10
+	case "Mi":
+		n *= 1 << 20
+	case "Gi":
+		n *= 1 << 30
+	}
+	return int64(n)
+}
+
+// emit sends an event to the frontend once the app has started
+func (m *RepoManager) emit(name string, data interface{}) {
+	m.ctxMu.RLock()
+	ctx := m.ctx
+	m.ctxMu.RUnlock()
+	if ctx != nil {
+		runtime.EventsEmit(ctx, name, data)
+	}
+}
@@ -0,0 +1,23 @@
+package repo
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value, unit string
+		want        int64
+	}{
+		{"512", "", 512},
+		{"1.50", "Ki", 1536},
+		{"2", "Mi", 2 << 20},
+		{"1", "Gi", 1 << 30},
+		{"abc", "Mi", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.unit, func(t *testing.T) {
+			if got := parseSize(tt.value, tt.unit); got != tt.want {
+				t.Errorf("parseSize(%q, %q) = %d, want %d", tt.value, tt.unit, got, tt.want)
+			}
+		})
+	}
+}
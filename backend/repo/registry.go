@@ -0,0 +1,433 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// indexFile holds the repo registry, relative to the repos directory
+const indexFile = "index.json"
+
+// RepoInfo is everything bskit knows about a repository
+type RepoInfo struct {
+	// ID is host/owner/name, e.g. github.com/acme/api
+	ID            string    `json:"id"`
+	Host          string    `json:"host"`
+	Owner         string    `json:"owner"`
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	RemoteURL     string    `json:"remoteUrl"`
+	DefaultBranch string    `json:"defaultBranch"`
+	ClonedAt      time.Time `json:"clonedAt"`
+	// LastBuildID and friends describe the most recent build of the repo
+	LastBuildID     string    `json:"lastBuildId,omitempty"`
+	LastBuildCommit string    `json:"lastBuildCommit,omitempty"`
+	LastBuildStatus string    `json:"lastBuildStatus,omitempty"`
+	LastBuildAt     time.Time `json:"lastBuildAt"`
+	// Tags are free-form labels set by the user
+	Tags []string `json:"tags"`
+	// Clone records how the repository was cloned; zero means a full clone
+	Clone CloneMode `json:"clone"`
+	// Local is true for existing checkouts registered with ImportLocalRepo.
+	// They live outside the workspace and are never deleted by bskit.
+	Local bool `json:"local,omitempty"`
+}
+
+// repoIndex is the on-disk registry, keyed by repo ID
+type repoIndex struct {
+	Repos map[string]*RepoInfo `json:"repos"`
+	// Worktrees are keyed by their path
+	Worktrees map[string]*Worktree `json:"worktrees,omitempty"`
+}
+
+// caseInsensitiveHosts serve the same repository whatever the case of its
+// owner and name, so those are lowercased to give it a single ID
+var caseInsensitiveHosts = map[string]bool{
+	"github.com":    true,
+	"gitlab.com":    true,
+	"bitbucket.org": true,
+}
+
+// ParseRepoURL splits a clone URL into host, owner and name. HTTPS, ssh://
+// and scp-like (git@host:owner/name.git) URLs are supported.
+func ParseRepoURL(rawURL string) (host, owner, name string, err error) {
+	rawURL = strings.TrimSpace(rawURL)
+
+	var path string
+	if u, parseErr := url.Parse(rawURL); parseErr == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if at := strings.Index(rawURL, "@"); at >= 0 && strings.Contains(rawURL[at:], ":") {
+		// scp-like syntax: user@host:owner/name.git
+		rest := rawURL[at+1:]
+		colon := strings.Index(rest, ":")
+		host, path = rest[:colon], rest[colon+1:]
+	} else {
+		return "", "", "", fmt.Errorf("invalid repository URL: %s", rawURL)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	if host == "" || len(parts) < 2 {
+		return "", "", "", fmt.Errorf("invalid repository URL: %s", rawURL)
+	}
+	// Owner and name become directories in the workspace
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return "", "", "", fmt.Errorf("invalid repository URL: %s", rawURL)
+		}
+	}
+
+	// Nested groups (e.g. GitLab subgroups) are kept as part of the owner
+	host = strings.ToLower(host)
+	owner = strings.Join(parts[:len(parts)-1], "/")
+	name = parts[len(parts)-1]
+	if caseInsensitiveHosts[host] {
+		owner, name = strings.ToLower(owner), strings.ToLower(name)
+	}
+	return host, owner, name, nil
+}
+
+// repoID builds the registry key of a repository
+func repoID(host, owner, name string) string {
+	return host + "/" + owner + "/" + name
+}
+
+// ListRepos returns the registered repositories that still exist on disk
+func (m *RepoManager) ListRepos() []*RepoInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	repos := make([]*RepoInfo, 0, len(m.index.Repos))
+	for _, info := range m.index.Repos {
+		if _, err := git.PlainOpen(info.Path); err != nil {
+			continue
+		}
+		repos = append(repos, info.copy())
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].ID < repos[j].ID
+	})
+	return repos
+}
+
+// GetRepo returns a registered repository by ID
+func (m *RepoManager) GetRepo(id string) (*RepoInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info, ok := m.index.Repos[id]
+	if !ok {
+		return nil, fmt.Errorf("repository not found: %s", id)
+	}
+	return info.copy(), nil
+}
+
+// RepoForPath returns the registered repository checked out at path
+func (m *RepoManager) RepoForPath(path string) (*RepoInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info := m.findByPath(path)
+	if info == nil {
+		return nil, fmt.Errorf("no registered repository at %s", path)
+	}
+	return info.copy(), nil
+}
+
+// ImportLocalRepo registers an existing checkout in place, without copying
+// it. path may be anywhere inside the working tree.
+func (m *RepoManager) ImportLocalRepo(path string) (*RepoInfo, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	r, err := git.PlainOpenWithOptions(absPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a git repository", path)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%s has no working tree: %w", path, err)
+	}
+
+	info, err := describeRepo(w.Filesystem.Root())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository: %w", err)
+	}
+	info.Local = true
+	info.ClonedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkNotMoving(); err != nil {
+		return nil, err
+	}
+	if existing := m.findByPath(info.Path); existing != nil {
+		return existing.copy(), nil
+	}
+	if existing, ok := m.index.Repos[info.ID]; ok {
+		if _, err := git.PlainOpen(existing.Path); err == nil {
+			return nil, fmt.Errorf("%s is already registered at %s", info.ID, existing.Path)
+		}
+	}
+	if err := m.register(info); err != nil {
+		return nil, err
+	}
+	return info.copy(), nil
+}
+
+// SetRepoTags replaces the user tags of a repository
+func (m *RepoManager) SetRepoTags(id string, tags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkNotMoving(); err != nil {
+		return err
+	}
+	info, ok := m.index.Repos[id]
+	if !ok {
+		return fmt.Errorf("repository not found: %s", id)
+	}
+	info.Tags = tags
+	return m.saveIndex()
+}
+
+// RecordBuild remembers the latest build of the repository at path. Paths
+// that aren't registered repositories are ignored.
+func (m *RepoManager) RecordBuild(path, buildID, commit, status string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkNotMoving(); err != nil {
+		return err
+	}
+	info := m.findByPath(path)
+	if info == nil {
+		return nil
+	}
+	info.LastBuildID = buildID
+	info.LastBuildCommit = commit
+	info.LastBuildStatus = status
+	info.LastBuildAt = at
+	return m.saveIndex()
+}
+
+// register adds a repository to the index. Callers must hold the write lock.
+func (m *RepoManager) register(info *RepoInfo) error {
+	if info.Tags == nil {
+		info.Tags = []string{}
+	}
+	m.index.Repos[info.ID] = info
+	return m.saveIndex()
+}
+
+// findByPath looks a repository up by its checkout path. Callers must hold the lock.
+func (m *RepoManager) findByPath(path string) *RepoInfo {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	for _, info := range m.index.Repos {
+		if info.Path == absPath {
+			return info
+		}
+	}
+	return nil
+}
+
+// lookup finds a registered repository by URL, ID or path. Callers must hold mu.
+func (m *RepoManager) lookup(ref string) *RepoInfo {
+	if host, owner, name, err := ParseRepoURL(ref); err == nil {
+		return m.index.Repos[repoID(host, owner, name)]
+	}
+	if info, ok := m.index.Repos[ref]; ok {
+		return info
+	}
+	if filepath.IsAbs(ref) {
+		return m.findByPath(ref)
+	}
+	return nil
+}
+
+// loadIndex reads the registry, registering repos cloned before it existed
+func (m *RepoManager) loadIndex() error {
+	index, err := readIndex(m.reposDir)
+	if err == nil {
+		m.index = index
+		if m.rekeyRepos() {
+			return m.saveIndex()
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	m.index = &repoIndex{Repos: make(map[string]*RepoInfo), Worktrees: make(map[string]*Worktree)}
+
+	// Older versions cloned straight into repos/<name>
+	entries, err := os.ReadDir(m.reposDir)
+	if err != nil {
+		return fmt.Errorf("failed to read repos directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := describeRepo(filepath.Join(m.reposDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if _, exists := m.index.Repos[info.ID]; !exists {
+			m.index.Repos[info.ID] = info
+		}
+	}
+	return m.saveIndex()
+}
+
+// rekeyRepos moves repos registered under an ID that is no longer the one
+// their URL parses to, e.g. mixed case GitHub IDs of older versions, and
+// reports whether any moved. Remote-less repos keep their ID; older versions
+// stored "local" as their owner, which is replaced by the owner in the ID.
+// Callers must hold the write lock.
+func (m *RepoManager) rekeyRepos() bool {
+	changed := false
+	for id, info := range m.index.Repos {
+		if info.Host == "local" {
+			owner := strings.TrimSuffix(strings.TrimPrefix(id, "local/"), "/"+info.Name)
+			if owner != info.Owner && repoID(info.Host, owner, info.Name) == id {
+				info.Owner = owner
+				changed = true
+			}
+			continue
+		}
+		if info.Local {
+			continue
+		}
+		host, owner, name, err := ParseRepoURL(info.RemoteURL)
+		if err != nil {
+			continue
+		}
+		newID := repoID(host, owner, name)
+		if newID == id {
+			continue
+		}
+		if _, taken := m.index.Repos[newID]; taken {
+			continue
+		}
+		info.ID, info.Host, info.Owner, info.Name = newID, host, owner, name
+		delete(m.index.Repos, id)
+		m.index.Repos[newID] = info
+		for _, w := range m.index.Worktrees {
+			if w.RepoID == id {
+				w.RepoID = newID
+			}
+		}
+		changed = true
+	}
+	return changed
+}
+
+// saveIndex writes the registry to disk. Callers must hold the write lock.
+func (m *RepoManager) saveIndex() error {
+	return writeIndex(m.reposDir, m.index)
+}
+
+// readIndex reads the registry of a workspace. A missing index is returned
+// as an os.IsNotExist error.
+func readIndex(reposDir string) (*repoIndex, error) {
+	data, err := os.ReadFile(filepath.Join(reposDir, indexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read repo index: %w", err)
+	}
+
+	index := &repoIndex{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse repo index: %w", err)
+	}
+	if index.Repos == nil {
+		index.Repos = make(map[string]*RepoInfo)
+	}
+	if index.Worktrees == nil {
+		index.Worktrees = make(map[string]*Worktree)
+	}
+	return index, nil
+}
+
+func writeIndex(reposDir string, index *repoIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode repo index: %w", err)
+	}
+
+	path := filepath.Join(reposDir, indexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write repo index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write repo index: %w", err)
+	}
+	return nil
+}
+
+// describeRepo builds the registry entry of an existing checkout from its origin remote
+func describeRepo(path string) (*RepoInfo, error) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &RepoInfo{Path: path, RemoteURL: remoteURL(path), Tags: []string{}}
+	if host, owner, name, err := ParseRepoURL(info.RemoteURL); err == nil {
+		info.Host, info.Owner, info.Name = host, owner, name
+		info.ID = repoID(host, owner, name)
+	} else {
+		// Repos without a usable remote are keyed by their directory. The
+		// path hash keeps checkouts with the same directory name apart.
+		sum := sha256.Sum256([]byte(path))
+		info.Host, info.Owner, info.Name = "local", hex.EncodeToString(sum[:4]), filepath.Base(path)
+		info.ID = repoID(info.Host, info.Owner, info.Name)
+	}
+
+	if head, err := r.Head(); err == nil && head.Name().IsBranch() {
+		info.DefaultBranch = head.Name().Short()
+	}
+	if stat, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+		info.ClonedAt = stat.ModTime()
+	}
+	return info, nil
+}
+
+// remoteURL returns the origin URL of the repository at path
+func remoteURL(path string) string {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return ""
+	}
+	remote, err := r.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
+func (info *RepoInfo) copy() *RepoInfo {
+	c := *info
+	c.Tags = append([]string{}, info.Tags...)
+	c.Clone.SparsePaths = append([]string(nil), info.Clone.SparsePaths...)
+	return &c
+}
@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestParseRepoURL(t *testing.T) {
+	tests := []struct {
+		url               string
+		host, owner, name string
+		wantErr           bool
+	}{
+		{url: "https://github.com/acme/api.git", host: "github.com", owner: "acme", name: "api"},
+		{url: "https://github.com/acme/api", host: "github.com", owner: "acme", name: "api"},
+		{url: "  https://GitHub.com/acme/api/  ", host: "github.com", owner: "acme", name: "api"},
+		{url: "https://gitlab.com:8443/group/sub/api.git", host: "gitlab.com", owner: "group/sub", name: "api"},
+		{url: "git@github.com:acme/api.git", host: "github.com", owner: "acme", name: "api"},
+		{url: "git@gitlab.com:group/sub/api", host: "gitlab.com", owner: "group/sub", name: "api"},
+		{url: "ssh://git@github.com/acme/api.git", host: "github.com", owner: "acme", name: "api"},
+		{url: "ssh://git@github.com:2222/acme/api.git", host: "github.com", owner: "acme", name: "api"},
+		{url: "https://github.com/Acme/API.git", host: "github.com", owner: "acme", name: "api"},
+		{url: "git@GitLab.com:Group/Sub/Api", host: "gitlab.com", owner: "group/sub", name: "api"},
+		{url: "https://git.example.com/Acme/API", host: "git.example.com", owner: "Acme", name: "API"},
+		{url: "", wantErr: true},
+		{url: "acme/api", wantErr: true},
+		{url: "https://github.com/api", wantErr: true},
+		{url: "https://github.com/acme//api", wantErr: true},
+		{url: "https://github.com/../api", wantErr: true},
+		{url: "https://github.com/acme/..", wantErr: true},
+		{url: "git@github.com:./api", wantErr: true},
+		{url: "git@:acme/api", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			host, owner, name, err := ParseRepoURL(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s %s %s", host, owner, name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if host != tt.host || owner != tt.owner || name != tt.name {
+				t.Errorf("got %s %s %s, want %s %s %s", host, owner, name, tt.host, tt.owner, tt.name)
+			}
+		})
+	}
+}
+
+func TestRekeyRepos(t *testing.T) {
+	m := &RepoManager{index: &repoIndex{
+		Repos: map[string]*RepoInfo{
+			"github.com/Acme/API":      {ID: "github.com/Acme/API", Host: "github.com", Owner: "Acme", Name: "API", RemoteURL: "https://github.com/Acme/API.git"},
+			"git.example.com/Acme/API": {ID: "git.example.com/Acme/API", Host: "git.example.com", Owner: "Acme", Name: "API", RemoteURL: "https://git.example.com/Acme/API"},
+			"local/1a2b3c4d/Tool":      {ID: "local/1a2b3c4d/Tool", Host: "local", Owner: "local", Name: "Tool", Local: true},
+		},
+		Worktrees: map[string]*Worktree{
+			"/wt/api-main": {RepoID: "github.com/Acme/API"},
+		},
+	}}
+
+	if !m.rekeyRepos() {
+		t.Fatal("expected the mixed case GitHub repo to be rekeyed")
+	}
+	info, ok := m.index.Repos["github.com/acme/api"]
+	if !ok {
+		t.Fatalf("repo not found under its new ID, got %v", m.index.Repos)
+	}
+	if info.ID != "github.com/acme/api" || info.Owner != "acme" || info.Name != "api" {
+		t.Errorf("unexpected repo %+v", info)
+	}
+	if _, ok := m.index.Repos["github.com/Acme/API"]; ok {
+		t.Error("old ID still registered")
+	}
+	if got := m.index.Worktrees["/wt/api-main"].RepoID; got != "github.com/acme/api" {
+		t.Errorf("worktree still points at %s", got)
+	}
+	if got := m.index.Repos["local/1a2b3c4d/Tool"].Owner; got != "1a2b3c4d" {
+		t.Errorf("local repo owner is %s, want the path hash of its ID", got)
+	}
+	for _, id := range []string{"git.example.com/Acme/API", "local/1a2b3c4d/Tool"} {
+		if _, ok := m.index.Repos[id]; !ok {
+			t.Errorf("%s should keep its ID", id)
+		}
+	}
+	if m.rekeyRepos() {
+		t.Error("expected nothing to rekey the second time")
+	}
+}
+
+func TestDescribeRepoWithoutRemote(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tool")
+	if _, err := git.PlainInit(dir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := describeRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Host != "local" || info.Name != "tool" {
+		t.Errorf("got host %s and name %s, want local and tool", info.Host, info.Name)
+	}
+	if want := repoID(info.Host, info.Owner, info.Name); info.ID != want {
+		t.Errorf("got ID %s, want %s", info.ID, want)
+	}
+}
@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Settings are the user's repository preferences, stored in the config directory
+type Settings struct {
+	// SSHKeyPath is the private key used for SSH remotes. When empty, ssh-agent
+	// and the default keys in ~/.ssh are tried.
+	SSHKeyPath string `json:"sshKeyPath"`
+	// WorkspaceDir is where repositories are cloned. When empty, bskit/repos
+	// in the user's data directory is used.
+	WorkspaceDir string `json:"workspaceDir"`
+}
+
+// GetSettings returns the current repository settings
+func (m *RepoManager) GetSettings() Settings {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings
+}
+
+// SaveSettings validates and stores the repository settings. Changing the
+// workspace moves every repository into it.
+func (m *RepoManager) SaveSettings(settings Settings) error {
+	if settings.SSHKeyPath != "" {
+		if _, err := os.Stat(settings.SSHKeyPath); err != nil {
+			return fmt.Errorf("SSH key not found: %s", settings.SSHKeyPath)
+		}
+	}
+	reposDir, err := workspaceDir(settings)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	moved := !samePath(reposDir, m.reposDir)
+	err = m.checkNotMoving()
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if moved {
+		return m.relocate(reposDir, settings)
+	}
+
+	if err := writeSettings(settings); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applySettings(settings)
+	return nil
+}
+
+// applySettings switches to saved settings. Callers must hold the write lock.
+func (m *RepoManager) applySettings(settings Settings) {
+	if settings.SSHKeyPath != m.settings.SSHKeyPath {
+		m.clearPassphrase()
+	}
+	m.settings = settings
+}
+
+func writeSettings(settings Settings) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// loadSettings reads the settings file; a missing file means defaults
+func loadSettings() (Settings, error) {
+	var settings Settings
+
+	path, err := settingsPath()
+	if err != nil {
+		return settings, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return settings, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("failed to parse settings: %w", err)
+	}
+	return settings, nil
+}
+
+func settingsPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, "bskit", "repos.json"), nil
+}
@@ -0,0 +1,201 @@
+package repo
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrPassphraseRequired is returned when the configured SSH key is encrypted
+// and no passphrase has been provided yet with SetSSHPassphrase
+var ErrPassphraseRequired = errors.New("the SSH key is protected by a passphrase")
+
+// HostKeyPrompt asks the user whether to trust a host key seen for the first
+// time, returning true to trust it
+type HostKeyPrompt func(host, keyType, fingerprint string) bool
+
+// SetHostKeyPrompt sets how unknown SSH host keys are confirmed. Without a
+// prompt unknown hosts are rejected.
+func (m *RepoManager) SetHostKeyPrompt(prompt HostKeyPrompt) {
+	m.tokensMu.Lock()
+	defer m.tokensMu.Unlock()
+	m.hostKeyPrompt = prompt
+}
+
+// SetSSHPassphrase provides the passphrase of the configured SSH key. It is
+// only kept in memory.
+func (m *RepoManager) SetSSHPassphrase(passphrase string) error {
+	m.mu.RLock()
+	keyPath := m.settings.SSHKeyPath
+	m.mu.RUnlock()
+	if keyPath == "" {
+		return fmt.Errorf("no SSH key configured")
+	}
+
+	// Check it now so the UI can ask again straight away
+	if _, err := gitssh.NewPublicKeysFromFile("git", keyPath, passphrase); err != nil {
+		return fmt.Errorf("failed to unlock SSH key: %w", err)
+	}
+
+	m.tokensMu.Lock()
+	defer m.tokensMu.Unlock()
+	m.passphrase = passphrase
+	return nil
+}
+
+func (m *RepoManager) clearPassphrase() {
+	m.tokensMu.Lock()
+	defer m.tokensMu.Unlock()
+	m.passphrase = ""
+}
+
+// isSSHURL reports whether a remote is reached over SSH
+func isSSHURL(remoteURL string) bool {
+	if strings.HasPrefix(remoteURL, "ssh://") || strings.HasPrefix(remoteURL, "git+ssh://") {
+		return true
+	}
+	// scp-like syntax: user@host:path
+	return !strings.Contains(remoteURL, "://") && strings.Contains(remoteURL, "@") && strings.Contains(remoteURL, ":")
+}
+
+// sshAuth picks SSH credentials for a remote: the configured key, then
+// ssh-agent, then the default keys in ~/.ssh
+func (m *RepoManager) sshAuth(remoteURL string, keyPath string) (transport.AuthMethod, error) {
+	user := sshUser(remoteURL)
+	hostKeyCallback, err := m.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	m.tokensMu.RLock()
+	passphrase := m.passphrase
+	m.tokensMu.RUnlock()
+
+	if keyPath != "" {
+		keys, err := gitssh.NewPublicKeysFromFile(user, keyPath, passphrase)
+		if err != nil {
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) || errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrPassphraseRequired
+			}
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", keyPath, err)
+		}
+		keys.HostKeyCallback = hostKeyCallback
+		return keys, nil
+	}
+
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		agent, err := gitssh.NewSSHAgentAuth(user)
+		if err == nil {
+			agent.HostKeyCallback = hostKeyCallback
+			return agent, nil
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			keys, err := gitssh.NewPublicKeysFromFile(user, filepath.Join(home, ".ssh", name), "")
+			if err == nil {
+				keys.HostKeyCallback = hostKeyCallback
+				return keys, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no SSH credentials available: start ssh-agent or configure an SSH key")
+}
+
+// hostKeyCallback verifies host keys against known_hosts. Unknown hosts are
+// confirmed through the prompt and then added; changed keys are always rejected.
+func (m *RepoManager) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsPath, err := knownHostsFile()
+	if err != nil {
+		return nil, err
+	}
+
+	m.tokensMu.RLock()
+	prompt := m.hostKeyPrompt
+	m.tokensMu.RUnlock()
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		check, err := knownhosts.New(knownHostsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", knownHostsPath, err)
+		}
+		err = check(hostname, remote, key)
+
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("the host key of %s has changed and may have been tampered with; "+
+				"remove the old key from %s if the change is expected", hostname, knownHostsPath)
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		if prompt == nil || !prompt(hostname, key.Type(), fingerprint) {
+			return fmt.Errorf("host key of %s (%s) was not trusted", hostname, fingerprint)
+		}
+		return appendKnownHost(knownHostsPath, hostname, remote, key)
+	}, nil
+}
+
+// knownHostsFile returns ~/.ssh/known_hosts, creating it when missing
+func knownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	path := filepath.Join(home, ".ssh", "known_hosts")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create ~/.ssh: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	f.Close()
+	return path, nil
+}
+
+func appendKnownHost(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil {
+		if addr := knownhosts.Normalize(remote.String()); addr != addresses[0] {
+			addresses = append(addresses, addr)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(knownhosts.Line(addresses, key) + "\n"); err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	return nil
+}
+
+// sshUser is the user in an SSH remote URL, git by default
+func sshUser(remoteURL string) string {
+	if u, err := url.Parse(remoteURL); err == nil && u.User != nil && u.User.Username() != "" {
+		return u.User.Username()
+	}
+	if at := strings.Index(remoteURL, "@"); at > 0 && !strings.Contains(remoteURL[:at], "/") {
+		return remoteURL[:at]
+	}
+	return "git"
+}
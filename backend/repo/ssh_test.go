@@ -0,0 +1,45 @@
+package repo
+
+import "testing"
+
+func TestIsSSHURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"ssh://git@github.com/acme/api.git", true},
+		{"git+ssh://git@github.com/acme/api.git", true},
+		{"git@github.com:acme/api.git", true},
+		{"https://github.com/acme/api.git", false},
+		{"https://user@github.com/acme/api.git", false},
+		{"http://github.com:8080/acme/api.git", false},
+		{"/srv/git/api.git", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := isSSHURL(tt.url); got != tt.want {
+				t.Errorf("isSSHURL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHUser(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"ssh://deploy@github.com/acme/api.git", "deploy"},
+		{"ssh://github.com/acme/api.git", "git"},
+		{"git@github.com:acme/api.git", "git"},
+		{"deploy@gitlab.com:group/api.git", "deploy"},
+		{"github.com:acme/api.git", "git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := sshUser(tt.url); got != tt.want {
+				t.Errorf("sshUser(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
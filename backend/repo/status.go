@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// CommitInfo describes a single commit
+type CommitInfo struct {
+	Hash      string `json:"hash"`
+	ShortHash string `json:"shortHash"`
+	Author    string `json:"author"`
+	Email     string `json:"email"`
+	// Message is the first line of the commit message
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// GetPathStatus reports the working tree status of the checkout at path,
+// which need not be registered, e.g. a directory picked for a build
+func (m *RepoManager) GetPathStatus(path string) (*RepoStatus, error) {
+	r, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a git repository", path)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%s has no working tree: %w", path, err)
+	}
+
+	status := &RepoStatus{IsCloned: true, Path: w.Filesystem.Root()}
+	if info, err := m.RepoForPath(status.Path); err == nil {
+		status.Repo = info
+	}
+	workingTreeStatus(status)
+	return status, nil
+}
+
+// workingTreeStatus fills in the branch, HEAD commit, changes and upstream
+// state of a checkout. git status is used for the changes rather than
+// go-git, which is slow on large trees and doesn't report upstream state.
+func workingTreeStatus(status *RepoStatus) {
+	// Linked worktrees keep their objects and refs in the main repository
+	opts := &git.PlainOpenOptions{EnableDotGitCommonDir: true}
+	if r, err := git.PlainOpenWithOptions(status.Path, opts); err == nil {
+		if head, err := r.Head(); err == nil {
+			if commit, err := r.CommitObject(head.Hash()); err == nil {
+				hash := commit.Hash.String()
+				status.Head = &CommitInfo{
+					Hash:      hash,
+					ShortHash: hash[:7],
+					Author:    commit.Author.Name,
+					Email:     commit.Author.Email,
+					Message:   strings.TrimSpace(strings.SplitN(commit.Message, "\n", 2)[0]),
+					Time:      commit.Author.When,
+				}
+			}
+		}
+	}
+
+	out, err := runGit(status.Path, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		status.StatusError = err.Error()
+		return
+	}
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			if branch := strings.TrimPrefix(line, "# branch.head "); branch != "(detached)" {
+				status.Branch = branch
+			}
+		case strings.HasPrefix(line, "# branch.upstream "):
+			status.Upstream = strings.TrimPrefix(line, "# branch.upstream ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			// e.g. "# branch.ab +2 -1"
+			fields := strings.Fields(strings.TrimPrefix(line, "# branch.ab "))
+			if len(fields) == 2 {
+				status.Ahead, _ = strconv.Atoi(strings.TrimPrefix(fields[0], "+"))
+				status.Behind, _ = strconv.Atoi(strings.TrimPrefix(fields[1], "-"))
+			}
+		case strings.HasPrefix(line, "1 "), strings.HasPrefix(line, "2 "), strings.HasPrefix(line, "u "):
+			status.Modified++
+		case strings.HasPrefix(line, "? "):
+			status.Untracked++
+		}
+	}
+	status.Dirty = status.Modified > 0 || status.Untracked > 0
+
+	if status.Repo != nil && status.Head != nil {
+		status.BuildMatchesHead = status.Repo.LastBuildCommit == status.Head.Hash && !status.Dirty
+	}
+}
@@ -0,0 +1,460 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// WorkspaceInfo describes where repositories are stored and how much space they take
+type WorkspaceInfo struct {
+	Path string `json:"path"`
+	// Default is true when no workspace directory is configured
+	Default   bool        `json:"default"`
+	UsedBytes int64       `json:"usedBytes"`
+	Repos     []RepoUsage `json:"repos"`
+}
+
+// RepoUsage is the disk space used by one repository
+type RepoUsage struct {
+	ID    string `json:"id"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// GetWorkspaceInfo reports the workspace path and the disk space used by
+// each repository in it, largest first
+func (m *RepoManager) GetWorkspaceInfo() (*WorkspaceInfo, error) {
+	m.mu.RLock()
+	info := &WorkspaceInfo{
+		Path:    m.reposDir,
+		Default: m.settings.WorkspaceDir == "",
+	}
+	m.mu.RUnlock()
+
+	used, err := dirSize(info.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure workspace: %w", err)
+	}
+	info.UsedBytes = used
+
+	info.Repos = []RepoUsage{}
+	for _, repo := range m.ListRepos() {
+		if repo.Local {
+			continue
+		}
+		size, err := dirSize(repo.Path)
+		if err != nil {
+			continue
+		}
+		info.Repos = append(info.Repos, RepoUsage{ID: repo.ID, Path: repo.Path, Bytes: size})
+	}
+	sort.Slice(info.Repos, func(i, j int) bool {
+		return info.Repos[i].Bytes > info.Repos[j].Bytes
+	})
+	return info, nil
+}
+
+// workspaceDir is the configured workspace, or bskit/repos in the user's data directory
+func workspaceDir(settings Settings) (string, error) {
+	if settings.WorkspaceDir != "" {
+		return filepath.Abs(settings.WorkspaceDir)
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "bskit", "repos"), nil
+}
+
+// userDataDir follows the XDG base directory spec, with the usual locations
+// on Windows and macOS
+func userDataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+			return dir, nil
+		}
+	case "darwin":
+		// ~/Library/Application Support
+		return os.UserConfigDir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+// legacyWorkspaceDir is where older versions cloned repos, next to the executable
+func legacyWorkspaceDir() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(execPath), "repos")
+}
+
+// migrateLegacyWorkspace moves repos cloned by older versions into the
+// workspace. It only runs while the workspace has no index of its own.
+func migrateLegacyWorkspace(reposDir string) error {
+	legacy := legacyWorkspaceDir()
+	if legacy == "" || samePath(legacy, reposDir) {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(reposDir, indexFile)); err == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(legacy)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+
+	log.Printf("Moving repositories from %s to %s", legacy, reposDir)
+	return moveWorkspace(legacy, reposDir)
+}
+
+// moveWorkspace moves every repository and the index from one workspace to
+// another. Linked worktrees are dropped, they are recreated on demand. On
+// failure everything is moved back, so the old workspace stays usable.
+func moveWorkspace(from, to string) error {
+	mv := &workspaceMove{from: from, to: to}
+	if err := mv.moveRepos(nil); err != nil {
+		return err
+	}
+
+	// Workspaces from before the index are registered when first loaded
+	index, err := readIndex(from)
+	if err == nil {
+		err = writeIndex(to, mv.rewriteIndex(index))
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		mv.rollback()
+		return err
+	}
+
+	mv.cleanup()
+	return nil
+}
+
+// workspaceMove moves the repositories of a workspace in steps: moveRepos
+// puts them in the new workspace, the caller then writes the index there,
+// and cleanup deletes what is left of the old one. Until the index is
+// written, rollback restores the old workspace.
+type workspaceMove struct {
+	from, to string
+	moved    []movedEntry
+}
+
+type movedEntry struct {
+	src, dst string
+	// copied entries were copied across volumes and still exist at src
+	copied bool
+}
+
+// moveRepos moves every entry of the workspace except the index and linked
+// worktrees, reporting how many are done. On failure the entries already
+// moved are moved back.
+func (mv *workspaceMove) moveRepos(report func(done, total int)) error {
+	if isWithin(mv.to, mv.from) || isWithin(mv.from, mv.to) {
+		return fmt.Errorf("the workspace can't be moved into or out of itself")
+	}
+	if err := os.MkdirAll(mv.to, 0755); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	all, err := os.ReadDir(mv.from)
+	if err != nil {
+		return fmt.Errorf("failed to read workspace: %w", err)
+	}
+
+	var entries []string
+	for _, entry := range all {
+		switch entry.Name() {
+		case worktreesDir, indexFile, indexFile + ".tmp":
+			continue
+		}
+		entries = append(entries, entry.Name())
+	}
+	if _, err := os.Stat(filepath.Join(mv.to, indexFile)); err == nil {
+		return fmt.Errorf("%s already contains a workspace", mv.to)
+	}
+	for _, name := range entries {
+		if _, err := os.Lstat(filepath.Join(mv.to, name)); err == nil {
+			return fmt.Errorf("%s already exists in %s", name, mv.to)
+		}
+	}
+
+	for i, name := range entries {
+		if report != nil {
+			report(i, len(entries))
+		}
+		entry := movedEntry{src: filepath.Join(mv.from, name), dst: filepath.Join(mv.to, name)}
+		if err := os.Rename(entry.src, entry.dst); err != nil {
+			// Another volume; the source is only deleted once the move is done
+			if err := copyDir(entry.src, entry.dst); err != nil {
+				os.RemoveAll(entry.dst)
+				mv.rollback()
+				return fmt.Errorf("failed to copy %s: %w", entry.src, err)
+			}
+			entry.copied = true
+		}
+		mv.moved = append(mv.moved, entry)
+	}
+	if report != nil {
+		report(len(entries), len(entries))
+	}
+	return nil
+}
+
+// rewriteIndex returns a copy of index with the repositories in the new
+// workspace and no worktrees, which were left in the old one
+func (mv *workspaceMove) rewriteIndex(index *repoIndex) *repoIndex {
+	rewritten := &repoIndex{
+		Repos:     make(map[string]*RepoInfo, len(index.Repos)),
+		Worktrees: make(map[string]*Worktree),
+	}
+	for id, info := range index.Repos {
+		info = info.copy()
+		if isWithin(info.Path, mv.from) {
+			rel, _ := filepath.Rel(mv.from, info.Path)
+			info.Path = filepath.Join(mv.to, rel)
+		}
+		rewritten.Repos[id] = info
+	}
+	return rewritten
+}
+
+// rollback moves everything back to the old workspace
+func (mv *workspaceMove) rollback() {
+	for i := len(mv.moved) - 1; i >= 0; i-- {
+		entry := mv.moved[i]
+		if entry.copied {
+			os.RemoveAll(entry.dst)
+		} else if err := os.Rename(entry.dst, entry.src); err != nil {
+			log.Printf("Failed to move %s back to %s: %v", entry.dst, entry.src, err)
+		}
+	}
+	mv.moved = nil
+}
+
+// cleanup deletes what is left of the old workspace once the new one is in
+// use, and makes the moved repos forget their old worktrees
+func (mv *workspaceMove) cleanup() {
+	for _, entry := range mv.moved {
+		if entry.copied {
+			if err := os.RemoveAll(entry.src); err != nil {
+				log.Printf("Failed to remove %s after moving it: %v", entry.src, err)
+			}
+		}
+	}
+	os.RemoveAll(filepath.Join(mv.from, worktreesDir))
+	os.Remove(filepath.Join(mv.from, indexFile))
+	// Leave nothing behind unless something else lives there
+	os.Remove(mv.from)
+
+	filepath.WalkDir(mv.to, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			runGit(path, "worktree", "prune")
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// dirSize adds up the size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear while a clone or build is running
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size, err
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func samePath(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// checkNotMoving refuses changes to repositories or the index while the
+// workspace is being moved. Callers must hold mu.
+func (m *RepoManager) checkNotMoving() error {
+	if m.moving {
+		return fmt.Errorf("the workspace is being moved, try again once it is done")
+	}
+	return nil
+}
+
+// beginOp registers an operation that changes a repository without holding
+// mu, so the workspace isn't moved while it runs. done ends the operation.
+func (m *RepoManager) beginOp() (done func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkNotMoving(); err != nil {
+		return nil, err
+	}
+	m.ops++
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.ops--
+	}, nil
+}
+
+// relocate moves all repositories to a new workspace and then switches to
+// it and to the new settings, which are saved first. The repos are moved
+// without holding mu; anything else that changes repositories or the index
+// is refused meanwhile.
+func (m *RepoManager) relocate(reposDir string, settings Settings) error {
+	m.mu.Lock()
+	switch {
+	case m.moving:
+		m.mu.Unlock()
+		return fmt.Errorf("the workspace is already being moved")
+	case len(m.clones) > 0:
+		m.mu.Unlock()
+		return fmt.Errorf("wait for clones to finish before moving the workspace")
+	case m.ops > 0 || len(m.busyWorktrees) > 0:
+		m.mu.Unlock()
+		return fmt.Errorf("wait for fetches, pulls and builds to finish before moving the workspace")
+	}
+	if entries, err := os.ReadDir(filepath.Join(m.reposDir, worktreesDir)); err == nil && len(entries) > 0 {
+		m.mu.Unlock()
+		return fmt.Errorf("remove worktrees and previews before moving the workspace")
+	}
+	m.moving = true
+	mv := &workspaceMove{from: m.reposDir, to: reposDir}
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		m.moving = false
+		m.mu.Unlock()
+	}()
+
+	progress := Progress{Operation: "move", Phase: "Moving repositories"}
+	err := mv.moveRepos(func(done, total int) {
+		progress.Current, progress.Total = int64(done), int64(total)
+		if total > 0 {
+			progress.Percent = done * 100 / total
+		}
+		m.emit("repo:progress", progress)
+	})
+	if err != nil {
+		progress.Phase = "failed"
+		m.emit("repo:progress", progress)
+		return fmt.Errorf("failed to move workspace: %w", err)
+	}
+
+	m.mu.Lock()
+	index := mv.rewriteIndex(m.index)
+	err = writeIndex(reposDir, index)
+	if err == nil {
+		if err = writeSettings(settings); err != nil {
+			os.Remove(filepath.Join(reposDir, indexFile))
+		}
+	}
+	if err != nil {
+		m.mu.Unlock()
+		mv.rollback()
+		progress.Phase = "failed"
+		m.emit("repo:progress", progress)
+		return fmt.Errorf("failed to move workspace: %w", err)
+	}
+	m.reposDir = reposDir
+	m.index = index
+	m.applySettings(settings)
+	m.mu.Unlock()
+
+	mv.cleanup()
+	progress.Phase, progress.Percent = "done", 100
+	m.emit("repo:progress", progress)
+	return nil
+}
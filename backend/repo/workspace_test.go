@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestMovingRefusesChanges(t *testing.T) {
+	m := &RepoManager{
+		reposDir:      t.TempDir(),
+		index:         &repoIndex{Repos: map[string]*RepoInfo{}, Worktrees: map[string]*Worktree{}},
+		clones:        map[string]context.CancelFunc{},
+		busyWorktrees: map[string]bool{},
+		moving:        true,
+	}
+	if _, err := git.PlainInit(m.reposDir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"clone", func() error {
+			_, err := m.CloneRepoWithOptions(CloneOptions{URL: "https://github.com/acme/api"})
+			return err
+		}},
+		{"fetch", func() error { return m.FetchRepo(m.reposDir) }},
+		{"pull", func() error { return m.PullRepo(m.reposDir) }},
+		{"checkout", func() error { return m.Checkout(m.reposDir, "main") }},
+		{"fetch ref", func() error { _, err := m.FetchRef(m.reposDir, "main"); return err }},
+		{"deepen", func() error { return m.DeepenRepo(m.reposDir, 0) }},
+		{"widen", func() error { return m.WidenRepo(m.reposDir, WidenOptions{AllBranches: true}) }},
+		{"import", func() error { _, err := m.ImportLocalRepo(m.reposDir); return err }},
+		{"delete", func() error { return m.DeleteRepo(m.reposDir) }},
+		{"tags", func() error { return m.SetRepoTags("github.com/acme/api", nil) }},
+		{"record build", func() error { return m.RecordBuild(m.reposDir, "1", "abc", "succeeded", time.Now()) }},
+		{"add worktree", func() error { _, err := m.AddWorktree(m.reposDir, "wt", "HEAD"); return err }},
+		{"settings", func() error { return m.SaveSettings(Settings{WorkspaceDir: m.reposDir}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(); err == nil || !strings.Contains(err.Error(), "being moved") {
+				t.Errorf("expected the move to refuse it, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRelocateWaitsForOperations(t *testing.T) {
+	m := &RepoManager{
+		reposDir:      t.TempDir(),
+		index:         &repoIndex{Repos: map[string]*RepoInfo{}, Worktrees: map[string]*Worktree{}},
+		busyWorktrees: map[string]bool{},
+	}
+
+	done, err := m.beginOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.relocate(t.TempDir(), Settings{}); err == nil {
+		t.Fatal("expected the move to wait for the running operation")
+	}
+	done()
+
+	m.busyWorktrees["/tmp/wt"] = true
+	if err := m.relocate(t.TempDir(), Settings{}); err == nil {
+		t.Fatal("expected the move to wait for the reserved worktree")
+	}
+	if m.moving || m.ops != 0 {
+		t.Errorf("refused moves must leave the manager idle, got moving=%v ops=%d", m.moving, m.ops)
+	}
+}
@@ -0,0 +1,433 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// worktreesDir holds linked worktrees, next to the cloned repos
+const worktreesDir = ".worktrees"
+
+// FetchRef fetches a branch, tag or other ref (e.g. pull/42/head) from origin
+// and returns the commit it points to. Progress is reported with repo:progress events.
+func (m *RepoManager) FetchRef(repoPath, ref string) (string, error) {
+	done, err := m.beginOp()
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository: %w", err)
+	}
+	url := remoteURL(repoPath)
+	auth, err := m.remoteAuth(url)
+	if err != nil {
+		return "", err
+	}
+	remoteRef, err := m.resolveRemoteRef(context.Background(), url, ref, auth)
+	if err != nil {
+		return "", err
+	}
+	localRef := fetchedRefName(remoteRef)
+
+	opts := &git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", remoteRef, localRef))},
+		Auth:       auth,
+		Tags:       git.NoTags,
+	}
+	var mode CloneMode
+	if info, err := m.RepoForPath(repoPath); err == nil {
+		mode = info.Clone
+	}
+	opts.Depth = shallowDepth(r, mode)
+
+	progress := m.newProgressWriter(m.idForPath(repoPath), "fetch")
+	opts.Progress = progress
+	if err := r.Fetch(opts); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		progress.finish("failed")
+		return "", fmt.Errorf("failed to fetch %s: %w", ref, m.accessError(url, err))
+	}
+	progress.finish("done")
+
+	fetched, err := r.Reference(localRef, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+	return tagCommit(r, fetched).String(), nil
+}
+
+// fetchedRefName is where FetchRef stores a remote ref: branches update their
+// origin branch and tags are kept as tags. Anything else, like pull request
+// heads, goes under refs/bskit so it doesn't show up as a branch.
+func fetchedRefName(remoteRef plumbing.ReferenceName) plumbing.ReferenceName {
+	switch {
+	case remoteRef.IsBranch():
+		return plumbing.NewRemoteReferenceName("origin", remoteRef.Short())
+	case remoteRef.IsTag():
+		return remoteRef
+	}
+	return plumbing.ReferenceName("refs/bskit/" + strings.TrimPrefix(remoteRef.String(), "refs/"))
+}
+
+// AddWorktree checks out commit into a new linked worktree of the repo and
+// returns its path. The worktree shares the object store with the repo, so
+// it is cheap to create and doesn't disturb the main checkout.
+func (m *RepoManager) AddWorktree(repoPath, name, commit string) (string, error) {
+	path := filepath.Join(m.worktreesPath(), name)
+	if err := m.reserveWorktree(path); err != nil {
+		return "", err
+	}
+	defer m.unreserveWorktree(path)
+
+	if err := addWorktree(repoPath, path, commit); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// CheckoutWorktree moves an existing worktree to another commit, discarding local changes
+func (m *RepoManager) CheckoutWorktree(worktreePath, commit string) error {
+	done, err := m.beginOp()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if _, err := runGit(worktreePath, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return fmt.Errorf("failed to check out %s: %w", commit, err)
+	}
+	return nil
+}
+
+// RemoveWorktree deletes a linked worktree of the repo. Worktrees in use by
+// a build can't be removed.
+func (m *RepoManager) RemoveWorktree(repoPath, worktreePath string) error {
+	if err := m.reserveWorktree(worktreePath); err != nil {
+		return err
+	}
+	defer m.unreserveWorktree(worktreePath)
+	return m.removeWorktree(repoPath, worktreePath)
+}
+
+// addWorktree runs git worktree add. The path must be reserved.
+func addWorktree(repoPath, path, commit string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("worktree %s already exists", filepath.Base(path))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create worktrees directory: %w", err)
+	}
+	if _, err := runGit(repoPath, "worktree", "add", "--detach", path, commit); err != nil {
+		return fmt.Errorf("failed to create worktree: %w", err)
+	}
+	return nil
+}
+
+// removeWorktree deletes a worktree and forgets it. The path must be reserved.
+func (m *RepoManager) removeWorktree(repoPath, worktreePath string) error {
+	if _, err := runGit(repoPath, "worktree", "remove", "--force", worktreePath); err != nil {
+		// Fall back to deleting the directory and letting git forget about it
+		if err := os.RemoveAll(worktreePath); err != nil {
+			return fmt.Errorf("failed to remove worktree: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	if _, ok := m.index.Worktrees[worktreePath]; ok {
+		delete(m.index.Worktrees, worktreePath)
+		if err := m.saveIndex(); err != nil {
+			m.mu.Unlock()
+			return err
+		}
+	}
+	m.mu.Unlock()
+
+	if _, err := runGit(repoPath, "worktree", "prune"); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w", err)
+	}
+	return nil
+}
+
+// reserveWorktree marks a worktree path as busy while it is created, used
+// by a build or removed, so git never runs on it twice at the same time
+func (m *RepoManager) reserveWorktree(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkNotMoving(); err != nil {
+		return err
+	}
+	if m.busyWorktrees[path] {
+		return fmt.Errorf("worktree %s is in use, try again once its build is done", filepath.Base(path))
+	}
+	m.busyWorktrees[path] = true
+	return nil
+}
+
+func (m *RepoManager) unreserveWorktree(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.busyWorktrees, path)
+}
+
+// runGit runs the git CLI in dir. It is only used for operations go-git does
+// not support: linked worktrees, sparse checkouts and reading the status of
+// large working trees.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("the git command line tool is required for this operation")
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", errors.New(msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Worktree is a checkout of one ref of a repository, used to build it
+// without touching the main checkout or other builds
+type Worktree struct {
+	Name     string `json:"name"`
+	RepoID   string `json:"repoId"`
+	RepoPath string `json:"repoPath"`
+	Path     string `json:"path"`
+	Ref      string `json:"ref"`
+	Commit   string `json:"commit"`
+	// Ephemeral worktrees are removed when released; named ones are kept and
+	// reused by the next build of the same name
+	Ephemeral bool      `json:"ephemeral"`
+	CreatedAt time.Time `json:"createdAt"`
+	UsedAt    time.Time `json:"usedAt"`
+	// LastBuildID and friends describe the most recent build in the worktree
+	LastBuildID     string    `json:"lastBuildId,omitempty"`
+	LastBuildStatus string    `json:"lastBuildStatus,omitempty"`
+	LastBuildAt     time.Time `json:"lastBuildAt"`
+}
+
+// WorktreeOptions configures CreateWorktree
+type WorktreeOptions struct {
+	// Ref is a branch, tag, commit or other ref such as pull/42/head
+	Ref string `json:"ref"`
+	// Name makes the worktree named and reusable; without it the worktree is ephemeral
+	Name string `json:"name"`
+}
+
+// CreateWorktree checks out a ref into its own worktree. The ref is fetched
+// from origin when possible, so branches build at their latest commit.
+func (m *RepoManager) CreateWorktree(repoPath string, opts WorktreeOptions) (*Worktree, error) {
+	if opts.Ref == "" {
+		return nil, fmt.Errorf("a ref is required")
+	}
+	info, err := m.RepoForPath(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := m.FetchRef(info.Path, opts.Ref)
+	if err != nil {
+		// Offline, or a commit or local branch origin doesn't advertise
+		local, localErr := runGit(info.Path, "rev-parse", "--verify", "--quiet", opts.Ref+"^{commit}")
+		if localErr != nil {
+			return nil, err
+		}
+		commit = local
+	}
+
+	name := worktreeName(info.Name, opts.Name)
+	if opts.Name == "" {
+		name = worktreeName(info.Name, fmt.Sprintf("%s-%x", opts.Ref, time.Now().UnixNano()))
+	}
+	path := filepath.Join(m.worktreesPath(), name)
+
+	// The worktree stays reserved until ReleaseWorktree
+	if err := m.reserveWorktree(path); err != nil {
+		return nil, err
+	}
+	w, err := m.checkoutWorktree(info, path, opts, commit)
+	if err != nil {
+		m.unreserveWorktree(path)
+		return nil, err
+	}
+	return w, nil
+}
+
+// checkoutWorktree moves a named worktree to commit, or creates the
+// worktree. The path must be reserved.
+func (m *RepoManager) checkoutWorktree(info *RepoInfo, path string, opts WorktreeOptions, commit string) (*Worktree, error) {
+	m.mu.RLock()
+	_, exists := m.index.Worktrees[path]
+	m.mu.RUnlock()
+	if exists {
+		if err := m.CheckoutWorktree(path, commit); err != nil {
+			return nil, err
+		}
+		return m.updateWorktree(path, func(w *Worktree) {
+			w.Ref, w.Commit, w.UsedAt = opts.Ref, commit, time.Now()
+		}), nil
+	}
+	if err := addWorktree(info.Path, path, commit); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	w := &Worktree{
+		Name:      filepath.Base(path),
+		RepoID:    info.ID,
+		RepoPath:  info.Path,
+		Path:      path,
+		Ref:       opts.Ref,
+		Commit:    commit,
+		Ephemeral: opts.Name == "",
+		CreatedAt: now,
+		UsedAt:    now,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.index.Worktrees[path] = w
+	if err := m.saveIndex(); err != nil {
+		return nil, err
+	}
+	c := *w
+	return &c, nil
+}
+
+// ReleaseWorktree is called when a build is done with a worktree. Ephemeral
+// worktrees are removed, named ones are kept for the next build.
+func (m *RepoManager) ReleaseWorktree(path string) error {
+	defer m.unreserveWorktree(path)
+
+	m.mu.RLock()
+	w, ok := m.index.Worktrees[path]
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("worktree not found: %s", path)
+	}
+	if w.Ephemeral {
+		return m.removeWorktree(w.RepoPath, path)
+	}
+	m.updateWorktree(path, func(w *Worktree) {
+		w.UsedAt = time.Now()
+	})
+	return nil
+}
+
+// RecordWorktreeBuild stores the outcome of the latest build of a worktree
+func (m *RepoManager) RecordWorktreeBuild(path, buildID, status string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.index.Worktrees[path]
+	if !ok {
+		return nil
+	}
+	w.LastBuildID = buildID
+	w.LastBuildStatus = status
+	w.LastBuildAt = at
+	return m.saveIndex()
+}
+
+// ListWorktrees returns the worktrees of a repository, or all worktrees if
+// repoPath is empty, most recently used first
+func (m *RepoManager) ListWorktrees(repoPath string) []*Worktree {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info := m.findByPath(repoPath)
+	worktrees := []*Worktree{}
+	for _, w := range m.index.Worktrees {
+		if repoPath != "" && (info == nil || w.RepoID != info.ID) {
+			continue
+		}
+		c := *w
+		worktrees = append(worktrees, &c)
+	}
+	sort.Slice(worktrees, func(i, j int) bool {
+		return worktrees[i].UsedAt.After(worktrees[j].UsedAt)
+	})
+	return worktrees
+}
+
+// cleanupWorktrees removes ephemeral worktrees left behind by a previous
+// run and forgets worktrees whose directory is gone
+func (m *RepoManager) cleanupWorktrees() {
+	m.mu.RLock()
+	var stale []*Worktree
+	for _, w := range m.index.Worktrees {
+		if _, err := os.Stat(w.Path); w.Ephemeral || err != nil {
+			stale = append(stale, w)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, w := range stale {
+		if err := m.RemoveWorktree(w.RepoPath, w.Path); err != nil {
+			log.Printf("Failed to clean up worktree %s: %v", w.Path, err)
+		}
+	}
+}
+
+// updateWorktree changes a tracked worktree and returns a copy of it
+func (m *RepoManager) updateWorktree(path string, update func(w *Worktree)) *Worktree {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.index.Worktrees[path]
+	if !ok {
+		return nil
+	}
+	update(w)
+	if err := m.saveIndex(); err != nil {
+		log.Printf("Failed to save worktree %s: %v", path, err)
+	}
+	c := *w
+	return &c
+}
+
+func (m *RepoManager) worktreesPath() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filepath.Join(m.reposDir, worktreesDir)
+}
+
+// worktreeName builds a directory name that is safe on every platform
+func worktreeName(repoName, name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+			return r
+		}
+		return '-'
+	}, repoName+"-"+name)
+	return strings.Trim(name, "-.")
+}
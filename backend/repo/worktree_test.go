@@ -0,0 +1,25 @@
+package repo
+
+import "testing"
+
+func TestWorktreeName(t *testing.T) {
+	tests := []struct {
+		repo, name string
+		want       string
+	}{
+		{"api", "main", "api-main"},
+		{"api", "feature/login", "api-feature-login"},
+		{"api", "v1.2.0", "api-v1.2.0"},
+		{"api", "fix bug #12", "api-fix-bug--12"},
+		{"api", "", "api"},
+		{"api", "..", "api"},
+		{".hidden", "wip.", "hidden-wip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo+"/"+tt.name, func(t *testing.T) {
+			if got := worktreeName(tt.repo, tt.name); got != tt.want {
+				t.Errorf("worktreeName(%q, %q) = %q, want %q", tt.repo, tt.name, got, tt.want)
+			}
+		})
+	}
+}
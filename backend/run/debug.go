@@ -0,0 +1,164 @@
+package run
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+)
+
+// Debug port defaults of each language's tooling
+const (
+	javaDebugPort = 8000
+	nodeDebugPort = 9229
+	goDebugPort   = 2345
+)
+
+// DebugInfo tells a debugger how to attach to a run started in debug mode
+type DebugInfo struct {
+	Language string `json:"language"`
+	// Protocol is jdwp, inspector or dap
+	Protocol      string `json:"protocol"`
+	ContainerPort int    `json:"containerPort"`
+	// Address is the host address the debug port is published on
+	Address string `json:"address"`
+	// Hint describes how to attach, e.g. which IDE setting or command to use
+	Hint string `json:"hint"`
+}
+
+// debugConfig works out the language of a buildpack image from its buildpacks
+// and returns the options adjusted to start it under a debugger
+func (m *RunManager) debugConfig(opts Options) (Options, *DebugInfo, error) {
+	info, err := m.dockerClient.ImageInspect(m.ctx, opts.Image)
+	if err != nil {
+		return opts, nil, fmt.Errorf("failed to inspect image: %w", err)
+	}
+	var labels map[string]string
+	if info.Config != nil {
+		labels = info.Config.Labels
+	}
+	metadata, err := parseBuildMetadata(labels)
+	if err != nil {
+		return opts, nil, err
+	}
+	if metadata == nil {
+		return opts, nil, fmt.Errorf("debug mode needs an image built by buildpacks")
+	}
+
+	var ids []string
+	for _, bp := range metadata.Buildpacks {
+		ids = append(ids, strings.ToLower(bp.ID))
+	}
+	has := func(keywords ...string) bool {
+		for _, id := range ids {
+			for _, k := range keywords {
+				if strings.Contains(id, k) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	env := make(map[string]string, len(opts.Env)+2)
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	opts.Env = env
+
+	var debug *DebugInfo
+	switch {
+	case has("java", "jvm", "liberica", "spring-boot", "gradle", "maven"):
+		// The JVM buildpacks turn on JDWP through these variables at launch
+		env["BPL_DEBUG_ENABLED"] = "true"
+		env["BPL_DEBUG_PORT"] = strconv.Itoa(javaDebugPort)
+		debug = &DebugInfo{
+			Language:      "java",
+			Protocol:      "jdwp",
+			ContainerPort: javaDebugPort,
+			Hint:          "Create a Remote JVM Debug configuration attaching to the address",
+		}
+
+	case has("node", "npm", "yarn"):
+		nodeOptions := fmt.Sprintf("--inspect=0.0.0.0:%d", nodeDebugPort)
+		if existing := env["NODE_OPTIONS"]; existing != "" {
+			nodeOptions = existing + " " + nodeOptions
+		}
+		env["NODE_OPTIONS"] = nodeOptions
+		debug = &DebugInfo{
+			Language:      "node",
+			Protocol:      "inspector",
+			ContainerPort: nodeDebugPort,
+			Hint:          "Attach from chrome://inspect or a Node.js attach configuration",
+		}
+
+	case has("go-build", "/go", "go-dist"):
+		cmd, args, err := m.processCommand(opts)
+		if err != nil {
+			return opts, nil, err
+		}
+		// Delve has to be available in the image, e.g. added through BP_GO_INSTALL_TOOLS
+		opts.ProcessType = ""
+		opts.Command = append([]string{
+			"dlv", "exec", "--headless", "--continue", "--accept-multiclient", "--api-version=2",
+			fmt.Sprintf("--listen=:%d", goDebugPort),
+			cmd, "--",
+		}, args...)
+		opts.Args = nil
+		debug = &DebugInfo{
+			Language:      "go",
+			Protocol:      "dap",
+			ContainerPort: goDebugPort,
+			Hint:          "Connect with dlv connect or a Go remote attach configuration. Build with BP_GO_BUILD_FLAGS=\"-gcflags=all=-N -l\" for accurate stepping.",
+		}
+
+	default:
+		return opts, nil, fmt.Errorf("debug mode is not supported for the buildpacks in %s", opts.Image)
+	}
+
+	// Only reachable from this machine; a debug port allows running arbitrary code
+	opts.Ports = append(append([]string{}, opts.Ports...), fmt.Sprintf("127.0.0.1::%d", debug.ContainerPort))
+	return opts, debug, nil
+}
+
+// processCommand returns the command and arguments of the process a run would start
+func (m *RunManager) processCommand(opts Options) (string, []string, error) {
+	if len(opts.Command) > 0 {
+		return opts.Command[0], append(append([]string{}, opts.Command[1:]...), opts.Args...), nil
+	}
+
+	processes, err := m.ListProcessTypes(opts.Image)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, p := range processes {
+		if (opts.ProcessType == "" && p.Default) || p.Type == opts.ProcessType {
+			if len(p.Command) == 0 {
+				break
+			}
+			args := append(append(append([]string{}, p.Command[1:]...), p.Args...), opts.Args...)
+			return p.Command[0], args, nil
+		}
+	}
+	return "", nil, fmt.Errorf("could not find the process to debug in %s", opts.Image)
+}
+
+// debugAddress looks up the host address the debug port of a container was published on
+func (m *RunManager) debugAddress(containerID string, port int) (string, error) {
+	info, err := m.dockerClient.ContainerInspect(m.ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if info.NetworkSettings == nil {
+		return "", fmt.Errorf("container has no network settings")
+	}
+
+	for _, b := range info.NetworkSettings.Ports[nat.Port(fmt.Sprintf("%d/tcp", port))] {
+		if b.HostPort != "" {
+			return net.JoinHostPort("127.0.0.1", b.HostPort), nil
+		}
+	}
+	return "", fmt.Errorf("debug port %d is not published", port)
+}
@@ -0,0 +1,128 @@
+package run
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// buildpacksMetadata returns build metadata listing the given buildpacks
+// and a web process running command
+func buildpacksMetadata(command string, ids ...string) string {
+	var buildpacks []string
+	for _, id := range ids {
+		buildpacks = append(buildpacks, `{"id": "`+id+`", "version": "1.0.0"}`)
+	}
+	return `{
+		"processes": [{"type": "web", "command": ["` + command + `"], "args": ["--port", "8080"]}],
+		"buildpacks": [` + strings.Join(buildpacks, ",") + `]
+	}`
+}
+
+func TestDebugConfig(t *testing.T) {
+	m := newTestManager(t, serveImages(map[string]*container.Config{
+		"java":     buildpackImage(buildpacksMetadata("java", "paketo-buildpacks/bellsoft-liberica", "paketo-buildpacks/maven"), "web"),
+		"node":     buildpackImage(buildpacksMetadata("node", "paketo-buildpacks/node-engine", "paketo-buildpacks/npm-install"), "web"),
+		"go":       buildpackImage(buildpacksMetadata("/layers/paketo-buildpacks_go-build/targets/bin/api", "paketo-buildpacks/go-dist", "paketo-buildpacks/go-build"), "web"),
+		"python":   buildpackImage(buildpacksMetadata("python", "paketo-buildpacks/cpython"), "web"),
+		"postgres": {Labels: map[string]string{}},
+	}))
+
+	t.Run("java", func(t *testing.T) {
+		opts, debug, err := m.debugConfig(Options{Image: "java", Env: map[string]string{"JAVA_OPTS": "-Xmx1g"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if debug.Language != "java" || debug.Protocol != "jdwp" || debug.ContainerPort != javaDebugPort {
+			t.Errorf("unexpected debug info %+v", debug)
+		}
+		if opts.Env["BPL_DEBUG_ENABLED"] != "true" || opts.Env["BPL_DEBUG_PORT"] != "8000" || opts.Env["JAVA_OPTS"] != "-Xmx1g" {
+			t.Errorf("unexpected env %v", opts.Env)
+		}
+		if !slices.Equal(opts.Ports, []string{"127.0.0.1::8000"}) {
+			t.Errorf("got ports %v, want the debug port on localhost only", opts.Ports)
+		}
+	})
+
+	t.Run("node", func(t *testing.T) {
+		env := map[string]string{"NODE_OPTIONS": "--max-old-space-size=512"}
+		ports := []string{"3000:3000"}
+		opts, debug, err := m.debugConfig(Options{Image: "node", Env: env, Ports: ports})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if debug.Language != "node" || debug.ContainerPort != nodeDebugPort {
+			t.Errorf("unexpected debug info %+v", debug)
+		}
+		if got := opts.Env["NODE_OPTIONS"]; got != "--max-old-space-size=512 --inspect=0.0.0.0:9229" {
+			t.Errorf("got NODE_OPTIONS %q", got)
+		}
+		if env["NODE_OPTIONS"] != "--max-old-space-size=512" || len(ports) != 1 {
+			t.Error("debugConfig modified the caller's options")
+		}
+		if !slices.Equal(opts.Ports, []string{"3000:3000", "127.0.0.1::9229"}) {
+			t.Errorf("got ports %v", opts.Ports)
+		}
+	})
+
+	t.Run("go", func(t *testing.T) {
+		opts, debug, err := m.debugConfig(Options{Image: "go", Args: []string{"--verbose"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if debug.Language != "go" || debug.Protocol != "dap" || debug.ContainerPort != goDebugPort {
+			t.Errorf("unexpected debug info %+v", debug)
+		}
+		want := []string{
+			"dlv", "exec", "--headless", "--continue", "--accept-multiclient", "--api-version=2", "--listen=:2345",
+			"/layers/paketo-buildpacks_go-build/targets/bin/api", "--", "--port", "8080", "--verbose",
+		}
+		if !slices.Equal(opts.Command, want) || opts.Args != nil || opts.ProcessType != "" {
+			t.Errorf("got command %v args %v process %q, want %v", opts.Command, opts.Args, opts.ProcessType, want)
+		}
+	})
+
+	for _, image := range []string{"python", "postgres", "missing"} {
+		t.Run(image, func(t *testing.T) {
+			if _, _, err := m.debugConfig(Options{Image: image}); err == nil {
+				t.Error("expected debug mode to be refused")
+			}
+		})
+	}
+}
+
+func TestDebugAddress(t *testing.T) {
+	m := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/c1/json" {
+			notFound(w)
+			return
+		}
+		info := container.InspectResponse{NetworkSettings: &container.NetworkSettings{}}
+		info.NetworkSettings.Ports = nat.PortMap{
+			"9229/tcp": {{HostIP: "127.0.0.1", HostPort: "49153"}},
+			"8000/tcp": {{HostIP: "127.0.0.1"}},
+		}
+		writeJSON(w, http.StatusOK, info)
+	})
+
+	addr, err := m.debugAddress("c1", nodeDebugPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "127.0.0.1:49153" {
+		t.Errorf("got %s, want 127.0.0.1:49153", addr)
+	}
+	if _, err := m.debugAddress("c1", javaDebugPort); err == nil {
+		t.Error("expected an error for a port without a host binding")
+	}
+	if _, err := m.debugAddress("c1", goDebugPort); err == nil {
+		t.Error("expected an error for an unpublished port")
+	}
+	if _, err := m.debugAddress("missing", nodeDebugPort); err == nil {
+		t.Error("expected an error for a missing container")
+	}
+}
@@ -0,0 +1,240 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// cnbLauncher sets up the buildpack environment before running a command
+const cnbLauncher = "/cnb/lifecycle/launcher"
+
+// lifecycleMetadataLabel is present on every image built by buildpacks
+const lifecycleMetadataLabel = "io.buildpacks.lifecycle.metadata"
+
+// ExecSession is an interactive TTY session inside a run's container
+type ExecSession struct {
+	ID      string   `json:"id"`
+	RunID   string   `json:"runId"`
+	Command []string `json:"command"`
+}
+
+// ExecOutput is emitted as an exec:output event with terminal output
+type ExecOutput struct {
+	SessionID string `json:"sessionId"`
+	Data      string `json:"data"`
+}
+
+type execSession struct {
+	ExecSession
+	execID string
+	conn   types.HijackedResponse
+	once   sync.Once
+}
+
+// OpenShell starts an interactive shell in a run. Buildpack images go through
+// the CNB launcher so the shell sees the same environment as the app.
+func (m *RunManager) OpenShell(runID string, cols, rows uint) (*ExecSession, error) {
+	return m.Exec(runID, nil, cols, rows)
+}
+
+// Exec starts an interactive TTY session running cmd inside a run. Output is
+// emitted as exec:output events and input is written with WriteExec.
+func (m *RunManager) Exec(runID string, cmd []string, cols, rows uint) (*ExecSession, error) {
+	run, err := m.Get(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd = m.execCommand(run.Image, cmd)
+
+	execOpts := container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          []string{"TERM=xterm-256color"},
+	}
+	if cols > 0 && rows > 0 {
+		execOpts.ConsoleSize = &[2]uint{rows, cols}
+	}
+
+	created, err := m.dockerClient.ContainerExecCreate(m.ctx, run.ContainerID, execOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec session: %w", err)
+	}
+
+	conn, err := m.dockerClient.ContainerExecAttach(m.ctx, created.ID, container.ExecAttachOptions{
+		Tty:         true,
+		ConsoleSize: execOpts.ConsoleSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec session: %w", err)
+	}
+
+	s := &execSession{
+		ExecSession: ExecSession{
+			ID:      newID(),
+			RunID:   runID,
+			Command: cmd,
+		},
+		execID: created.ID,
+		conn:   conn,
+	}
+
+	m.mu.Lock()
+	m.sessions[s.ID] = s
+	m.mu.Unlock()
+
+	go m.pumpExecOutput(s)
+
+	session := s.ExecSession
+	return &session, nil
+}
+
+// WriteExec sends input to an exec session
+func (m *RunManager) WriteExec(sessionID, data string) error {
+	s, err := m.session(sessionID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.Conn.Write([]byte(data)); err != nil {
+		return fmt.Errorf("failed to write to exec session: %w", err)
+	}
+	return nil
+}
+
+// ResizeExec resizes the TTY of an exec session
+func (m *RunManager) ResizeExec(sessionID string, cols, rows uint) error {
+	s, err := m.session(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := m.dockerClient.ContainerExecResize(m.ctx, s.execID, container.ResizeOptions{
+		Height: rows,
+		Width:  cols,
+	}); err != nil {
+		return fmt.Errorf("failed to resize exec session: %w", err)
+	}
+	return nil
+}
+
+// CloseExec ends an exec session
+func (m *RunManager) CloseExec(sessionID string) error {
+	s, err := m.session(sessionID)
+	if err != nil {
+		return err
+	}
+	m.closeSession(s)
+	return nil
+}
+
+func (m *RunManager) session(sessionID string) (*execSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("exec session not found: %s", sessionID)
+	}
+	return s, nil
+}
+
+func (m *RunManager) closeSession(s *execSession) {
+	s.once.Do(func() {
+		s.conn.Close()
+
+		m.mu.Lock()
+		delete(m.sessions, s.ID)
+		m.mu.Unlock()
+
+		exitCode := -1
+		// Use a fresh context, the app context may already be cancelled on shutdown
+		if info, err := m.dockerClient.ContainerExecInspect(context.Background(), s.execID); err == nil && !info.Running {
+			exitCode = info.ExitCode
+		}
+
+		runtime.EventsEmit(m.ctx, "exec:exit", map[string]interface{}{
+			"sessionId": s.ID,
+			"exitCode":  exitCode,
+		})
+	})
+}
+
+// pumpExecOutput forwards terminal output until the session ends, taking care
+// not to split multi-byte characters across events
+func (m *RunManager) pumpExecOutput(s *execSession) {
+	defer m.closeSession(s)
+
+	buf := make([]byte, 32*1024)
+	var pending []byte
+	for {
+		n, err := s.conn.Reader.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+
+			cut := completeRunes(pending)
+			if cut > 0 {
+				runtime.EventsEmit(m.ctx, "exec:output", ExecOutput{SessionID: s.ID, Data: string(pending[:cut])})
+				pending = append([]byte(nil), pending[cut:]...)
+			}
+		}
+		if err != nil {
+			if len(pending) > 0 {
+				runtime.EventsEmit(m.ctx, "exec:output", ExecOutput{SessionID: s.ID, Data: string(pending)})
+			}
+			return
+		}
+	}
+}
+
+// execCommand returns the command an exec session runs in a container of
+// imageName, defaulting to a shell when cmd is empty
+func (m *RunManager) execCommand(imageName string, cmd []string) []string {
+	buildpack := m.isBuildpackImage(imageName)
+	if len(cmd) == 0 {
+		cmd = []string{"/bin/sh"}
+		if buildpack {
+			cmd = []string{"bash"}
+		}
+	}
+	if buildpack && cmd[0] != cnbLauncher {
+		cmd = append([]string{cnbLauncher}, cmd...)
+	}
+	return cmd
+}
+
+// completeRunes returns the length of the prefix of p that does not end in
+// a partial multi-byte character
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// isBuildpackImage reports whether an image was built by buildpacks
+func (m *RunManager) isBuildpackImage(imageName string) bool {
+	info, err := m.dockerClient.ImageInspect(m.ctx, imageName)
+	if err != nil {
+		log.Printf("Failed to inspect image %s: %v", imageName, err)
+		return false
+	}
+	if info.Config == nil {
+		return false
+	}
+	_, ok := info.Config.Labels[lifecycleMetadataLabel]
+	return ok
+}
@@ -0,0 +1,73 @@
+package run
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestExecCommand(t *testing.T) {
+	m := newTestManager(t, serveImages(map[string]*container.Config{
+		"acme/api": {Labels: map[string]string{lifecycleMetadataLabel: "{}"}},
+		"postgres": {Labels: map[string]string{}},
+	}))
+
+	tests := []struct {
+		image string
+		cmd   []string
+		want  []string
+	}{
+		{image: "acme/api", want: []string{cnbLauncher, "bash"}},
+		{image: "acme/api", cmd: []string{"rails", "console"}, want: []string{cnbLauncher, "rails", "console"}},
+		{image: "acme/api", cmd: []string{cnbLauncher, "env"}, want: []string{cnbLauncher, "env"}},
+		{image: "postgres", want: []string{"/bin/sh"}},
+		{image: "postgres", cmd: []string{"psql"}, want: []string{"psql"}},
+		// Images that cannot be inspected are treated as plain images
+		{image: "missing", want: []string{"/bin/sh"}},
+	}
+	for _, tt := range tests {
+		if got := m.execCommand(tt.image, tt.cmd); !slices.Equal(got, tt.want) {
+			t.Errorf("%s %v: got %v, want %v", tt.image, tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestCompleteRunes(t *testing.T) {
+	euro := []byte("€") // three bytes
+	tests := []struct {
+		name string
+		p    []byte
+		want int
+	}{
+		{name: "empty", p: nil, want: 0},
+		{name: "ascii", p: []byte("ls -la\r\n"), want: 8},
+		{name: "complete rune", p: append([]byte("a"), euro...), want: 4},
+		{name: "partial rune", p: append([]byte("a"), euro[:2]...), want: 1},
+		{name: "only a partial rune", p: euro[:1], want: 0},
+		// Invalid bytes are passed through rather than held back forever
+		{name: "invalid", p: []byte{'a', 0xff}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := completeRunes(tt.p); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecSessionNotFound(t *testing.T) {
+	m := newTestManager(t, func(w http.ResponseWriter, r *http.Request) { notFound(w) })
+
+	if err := m.WriteExec("missing", "ls\n"); err == nil {
+		t.Error("expected an error writing to an unknown session")
+	}
+	if err := m.ResizeExec("missing", 80, 24); err == nil {
+		t.Error("expected an error resizing an unknown session")
+	}
+	if err := m.CloseExec("missing"); err == nil {
+		t.Error("expected an error closing an unknown session")
+	}
+}
@@ -0,0 +1,564 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Labels applied to every container bskit starts, so they can be found again
+// after the fact and told apart from the user's own containers.
+const (
+	LabelManaged     = "bskit.managed"
+	LabelRunID       = "bskit.run.id"
+	LabelRepo        = "bskit.repo"
+	LabelBranch      = "bskit.branch"
+	LabelEnvironment = "bskit.environment"
+	LabelService     = "bskit.service"
+)
+
+// Run statuses
+const (
+	StatusStarting = "starting"
+	StatusRunning  = "running"
+	StatusExited   = "exited"
+	StatusStopped  = "stopped"
+)
+
+type RunManager struct {
+	dockerClient *client.Client
+	ctx          context.Context
+	mu           sync.RWMutex
+	runs         map[string]*Run
+	sessions     map[string]*execSession
+	stats        map[string][]StatsSample
+}
+
+// Options describes a container to run
+type Options struct {
+	Image string `json:"image"`
+	// Name is used as the container name when set
+	Name string `json:"name"`
+	Repo string `json:"repo"`
+	// Branch is the git branch the image was built from, if known
+	Branch string `json:"branch"`
+	// Env holds extra environment variables for the container
+	Env map[string]string `json:"env"`
+	// Ports uses the docker CLI format, e.g. "3000", "8080:3000" or "127.0.0.1:5432:5432/tcp"
+	Ports []string `json:"ports"`
+	// Volumes are named volumes or host directories that survive restarts
+	Volumes     []VolumeMount     `json:"volumes"`
+	Network     string            `json:"network"`
+	Aliases     []string          `json:"aliases"`
+	Labels      map[string]string `json:"labels"`
+	HealthCheck *HealthCheck      `json:"healthCheck,omitempty"`
+	// ProcessType selects one of the processes defined by the buildpacks,
+	// e.g. "web" or "worker", instead of the default one
+	ProcessType string `json:"processType"`
+	// Command overrides the entrypoint of the image
+	Command []string `json:"command"`
+	// Args are passed to the process type, command or default entrypoint
+	Args []string `json:"args"`
+	// Debug starts the app under the debugger of its language and publishes the debug port
+	Debug bool `json:"debug"`
+}
+
+// HealthCheck mirrors the docker/compose healthcheck settings
+type HealthCheck struct {
+	// Test is the command to run, e.g. ["CMD-SHELL", "pg_isready -U postgres"]
+	Test        []string      `json:"test"`
+	Interval    time.Duration `json:"interval"`
+	Timeout     time.Duration `json:"timeout"`
+	Retries     int           `json:"retries"`
+	StartPeriod time.Duration `json:"startPeriod"`
+}
+
+// Run represents a container started by bskit
+type Run struct {
+	ID          string    `json:"id"`
+	ContainerID string    `json:"containerId"`
+	Name        string    `json:"name"`
+	Image       string    `json:"image"`
+	Repo        string    `json:"repo"`
+	Ports       []string  `json:"ports"`
+	Status      string    `json:"status"`
+	ExitCode    int       `json:"exitCode"`
+	StartedAt   time.Time `json:"startedAt"`
+	Options     Options   `json:"options"`
+	// Debug holds the connection details of a run started in debug mode
+	Debug *DebugInfo `json:"debug,omitempty"`
+}
+
+// RunLog is a single line of container output, emitted as a run:log event
+type RunLog struct {
+	RunID string `json:"runId"`
+	Line  string `json:"line"`
+}
+
+func NewRunManager(ctx context.Context) (*RunManager, error) {
+	dockerClient, err := client.NewClientWithOpts(
+		client.FromEnv,
+		client.WithVersion("1.47"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	return &RunManager{
+		dockerClient: dockerClient,
+		ctx:          ctx,
+		runs:         make(map[string]*Run),
+		sessions:     make(map[string]*execSession),
+		stats:        make(map[string][]StatsSample),
+	}, nil
+}
+
+// DockerClient returns the docker client shared by the run manager
+func (m *RunManager) DockerClient() *client.Client {
+	return m.dockerClient
+}
+
+// Start creates and starts a container for the given options
+func (m *RunManager) Start(opts Options) (*Run, error) {
+	if opts.Image == "" {
+		return nil, fmt.Errorf("no image specified")
+	}
+
+	if err := m.ensureImage(opts.Image); err != nil {
+		return nil, err
+	}
+
+	// Debug settings are derived on every start, so Options keeps what was
+	// asked for and restarts apply them afresh
+	createOpts := opts
+	var debug *DebugInfo
+	if opts.Debug {
+		var err error
+		createOpts, debug, err = m.debugConfig(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entrypoint, cmd, err := m.entrypoint(createOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(createOpts.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port mapping: %w", err)
+	}
+
+	mounts, err := m.mounts(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	runID := newID()
+	labels := map[string]string{
+		LabelManaged: "true",
+		LabelRunID:   runID,
+	}
+	if opts.Repo != "" {
+		labels[LabelRepo] = opts.Repo
+	}
+	if opts.Branch != "" {
+		labels[LabelBranch] = opts.Branch
+	}
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+
+	config := &container.Config{
+		Image:        opts.Image,
+		Entrypoint:   entrypoint,
+		Cmd:          cmd,
+		Env:          envList(createOpts.Env),
+		ExposedPorts: exposedPorts,
+		Labels:       labels,
+	}
+	if opts.HealthCheck != nil && len(opts.HealthCheck.Test) > 0 {
+		config.Healthcheck = &container.HealthConfig{
+			Test:        opts.HealthCheck.Test,
+			Interval:    opts.HealthCheck.Interval,
+			Timeout:     opts.HealthCheck.Timeout,
+			Retries:     opts.HealthCheck.Retries,
+			StartPeriod: opts.HealthCheck.StartPeriod,
+		}
+	}
+
+	hostConfig := &container.HostConfig{
+		PortBindings: portBindings,
+		Mounts:       mounts,
+	}
+
+	var networkingConfig *network.NetworkingConfig
+	if opts.Network != "" {
+		networkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				opts.Network: {Aliases: opts.Aliases},
+			},
+		}
+	}
+
+	resp, err := m.dockerClient.ContainerCreate(m.ctx, config, hostConfig, networkingConfig, nil, opts.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+
+	run := &Run{
+		ID:          runID,
+		ContainerID: resp.ID,
+		Name:        opts.Name,
+		Image:       opts.Image,
+		Repo:        opts.Repo,
+		Ports:       createOpts.Ports,
+		Status:      StatusStarting,
+		StartedAt:   time.Now(),
+		Options:     opts,
+	}
+
+	if err := m.dockerClient.ContainerStart(m.ctx, resp.ID, container.StartOptions{}); err != nil {
+		m.removeContainer(resp.ID)
+		return nil, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	if debug != nil {
+		if debug.Address, err = m.debugAddress(resp.ID, debug.ContainerPort); err != nil {
+			log.Printf("Failed to look up debug port of run %s: %v", runID, err)
+		}
+		run.Debug = debug
+	}
+
+	m.mu.Lock()
+	run.Status = StatusRunning
+	m.runs[runID] = run
+	m.mu.Unlock()
+
+	go m.streamLogs(run)
+	go m.streamStats(run)
+	go m.waitForExit(run)
+
+	runtime.EventsEmit(m.ctx, "run:started", run)
+	return run, nil
+}
+
+// Stop stops a run and removes its container
+func (m *RunManager) Stop(runID string) error {
+	m.mu.Lock()
+	run, ok := m.runs[runID]
+	if ok {
+		run.Status = StatusStopped
+	}
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("run not found: %s", runID)
+	}
+
+	if err := m.dockerClient.ContainerStop(m.ctx, run.ContainerID, container.StopOptions{}); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to stop container: %w", err)
+	}
+	m.removeContainer(run.ContainerID)
+
+	m.mu.Lock()
+	delete(m.runs, runID)
+	delete(m.stats, runID)
+	m.mu.Unlock()
+
+	runtime.EventsEmit(m.ctx, "run:stopped", runID)
+	return nil
+}
+
+// Restart replaces a run with a fresh container started from the same
+// options, picking up any newer build of its image
+func (m *RunManager) Restart(runID string) (*Run, error) {
+	old, err := m.Get(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Stop(runID); err != nil {
+		return nil, err
+	}
+
+	run, err := m.Start(old.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	runtime.EventsEmit(m.ctx, "run:restarted", map[string]string{
+		"previousRunId": runID,
+		"runId":         run.ID,
+	})
+	return run, nil
+}
+
+// Get returns a copy of the run with the given ID
+func (m *RunManager) Get(runID string) (*Run, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, ok := m.runs[runID]
+	if !ok {
+		return nil, fmt.Errorf("run not found: %s", runID)
+	}
+	r := *run
+	return &r, nil
+}
+
+// List returns all runs known to the manager, most recent first
+func (m *RunManager) List() []*Run {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	runs := make([]*Run, 0, len(m.runs))
+	for _, run := range m.runs {
+		r := *run
+		runs = append(runs, &r)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs
+}
+
+// HostPort returns the host address the first published port of a run is reachable on
+func (m *RunManager) HostPort(runID string) (string, error) {
+	run, err := m.Get(runID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(run.Ports) == 0 {
+		return "", fmt.Errorf("run %s does not publish any ports", runID)
+	}
+
+	info, err := m.dockerClient.ContainerInspect(m.ctx, run.ContainerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if info.NetworkSettings == nil {
+		return "", fmt.Errorf("run %s has no network settings", runID)
+	}
+
+	// Prefer the first port in the order the run asked for them
+	for _, spec := range run.Ports {
+		mappings, err := nat.ParsePortSpec(spec)
+		if err != nil || len(mappings) == 0 {
+			continue
+		}
+		for _, b := range info.NetworkSettings.Ports[mappings[0].Port] {
+			if b.HostPort == "" {
+				continue
+			}
+			host := b.HostIP
+			if host == "" || host == "0.0.0.0" || host == "::" {
+				host = "127.0.0.1"
+			}
+			return net.JoinHostPort(host, b.HostPort), nil
+		}
+	}
+	return "", fmt.Errorf("run %s has no published ports", runID)
+}
+
+// ListByLabel returns the runs carrying the given label value
+func (m *RunManager) ListByLabel(key, value string) []*Run {
+	var runs []*Run
+	for _, run := range m.List() {
+		if run.Options.Labels[key] == value {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// WaitHealthy blocks until the run's container reports healthy. Containers
+// without a health check are considered healthy as soon as they are running.
+func (m *RunManager) WaitHealthy(runID string, timeout time.Duration) error {
+	run, err := m.Get(runID)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		info, err := m.dockerClient.ContainerInspect(m.ctx, run.ContainerID)
+		if err != nil {
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+		if info.State == nil || !info.State.Running {
+			return fmt.Errorf("container %s is not running", run.Name)
+		}
+		if info.State.Health == nil || info.State.Health.Status == container.Healthy {
+			return nil
+		}
+		if info.State.Health.Status == container.Unhealthy {
+			return fmt.Errorf("container %s is unhealthy", run.Name)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s to become healthy", run.Name)
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// ensureImage pulls the image if it is not available locally
+func (m *RunManager) ensureImage(imageName string) error {
+	_, err := m.dockerClient.ImageInspect(m.ctx, imageName)
+	if err == nil {
+		return nil
+	}
+	if !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to inspect image: %w", err)
+	}
+
+	runtime.EventsEmit(m.ctx, "build:log", fmt.Sprintf("Pulling %s...", imageName))
+	out, err := m.dockerClient.ImagePull(m.ctx, imageName, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	defer out.Close()
+
+	decoder := json.NewDecoder(out)
+	for {
+		var pullOutput struct {
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&pullOutput); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to decode pull output: %w", err)
+		}
+		if pullOutput.Error != "" {
+			return fmt.Errorf("failed to pull image: %s", pullOutput.Error)
+		}
+	}
+
+	return nil
+}
+
+func (m *RunManager) streamLogs(run *Run) {
+	logs, err := m.dockerClient.ContainerLogs(m.ctx, run.ContainerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		log.Printf("Failed to get logs for run %s: %v", run.ID, err)
+		return
+	}
+	defer logs.Close()
+
+	w := &logWriter{ctx: m.ctx, runID: run.ID}
+	if _, err := stdcopy.StdCopy(w, w, logs); err != nil && m.ctx.Err() == nil {
+		log.Printf("Error reading logs for run %s: %v", run.ID, err)
+	}
+}
+
+func (m *RunManager) waitForExit(run *Run) {
+	statusCh, errCh := m.dockerClient.ContainerWait(m.ctx, run.ContainerID, container.WaitConditionNotRunning)
+
+	exitCode := -1
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.Printf("Error waiting for run %s: %v", run.ID, err)
+		}
+	case status := <-statusCh:
+		exitCode = int(status.StatusCode)
+	}
+
+	m.mu.Lock()
+	if run.Status != StatusStopped {
+		run.Status = StatusExited
+	}
+	run.ExitCode = exitCode
+	m.mu.Unlock()
+
+	runtime.EventsEmit(m.ctx, "run:exited", map[string]interface{}{
+		"runId":    run.ID,
+		"exitCode": exitCode,
+	})
+}
+
+func (m *RunManager) removeContainer(containerID string) {
+	if err := m.dockerClient.ContainerRemove(m.ctx, containerID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		log.Printf("Warning: Failed to remove container: %v", err)
+	}
+}
+
+func envList(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := make([]string, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, k+"="+env[k])
+	}
+	return list
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// logWriter implements io.Writer and emits container output line by line
+type logWriter struct {
+	ctx    context.Context
+	runID  string
+	buffer []byte
+}
+
+func (w *logWriter) Write(p []byte) (n int, err error) {
+	w.buffer = append(w.buffer, p...)
+
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i == -1 {
+			break
+		}
+
+		line := w.buffer[:i]
+		w.buffer = w.buffer[i+1:]
+		if len(line) == 0 {
+			continue
+		}
+
+		runtime.EventsEmit(w.ctx, "run:log", RunLog{RunID: w.runID, Line: string(line)})
+	}
+
+	return len(p), nil
+}
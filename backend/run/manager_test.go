@@ -0,0 +1,71 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// newTestManager returns a run manager talking to a fake docker API served
+// by handler. Paths are passed without the API version prefix.
+func newTestManager(t *testing.T, handler http.HandlerFunc) *RunManager {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v1.47")
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	dockerClient, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		client.WithHTTPClient(srv.Client()),
+		client.WithVersion("1.47"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &RunManager{
+		dockerClient: dockerClient,
+		ctx:          context.Background(),
+		runs:         make(map[string]*Run),
+		sessions:     make(map[string]*execSession),
+		stats:        make(map[string][]StatsSample),
+	}
+}
+
+// writeJSON answers a fake docker API request
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// notFound answers like the docker API does for missing objects
+func notFound(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, map[string]string{"message": "not found"})
+}
+
+// serveImages answers image inspect requests from a map of image configs
+func serveImages(images map[string]*container.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutPrefix(r.URL.Path, "/images/")
+		name, isInspect := strings.CutSuffix(name, "/json")
+		if !ok || !isInspect || r.Method != http.MethodGet {
+			notFound(w)
+			return
+		}
+		config, ok := images[name]
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, image.InspectResponse{ID: "sha256:" + name, Config: config})
+	}
+}
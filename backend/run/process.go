@@ -0,0 +1,128 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// buildMetadataLabel describes the buildpacks and processes of a CNB image
+const buildMetadataLabel = "io.buildpacks.build.metadata"
+
+// processEntrypointDir holds one entrypoint per process type in CNB images
+const processEntrypointDir = "/cnb/process/"
+
+// ProcessType is a process defined by the buildpacks of an image
+type ProcessType struct {
+	Type    string   `json:"type"`
+	Command []string `json:"command"`
+	Args    []string `json:"args"`
+	Direct  bool     `json:"direct"`
+	Default bool     `json:"default"`
+}
+
+// buildMetadata is the part of io.buildpacks.build.metadata we care about
+type buildMetadata struct {
+	Processes []struct {
+		Type string `json:"type"`
+		// Command is a string on older platform APIs and a list on newer ones
+		Command json.RawMessage `json:"command"`
+		Args    []string        `json:"args"`
+		Direct  bool            `json:"direct"`
+	} `json:"processes"`
+	Buildpacks []struct {
+		ID      string `json:"id"`
+		Version string `json:"version"`
+	} `json:"buildpacks"`
+}
+
+// ListProcessTypes returns the process types of a buildpack image. Images not
+// built by buildpacks have none.
+func (m *RunManager) ListProcessTypes(imageName string) ([]ProcessType, error) {
+	info, err := m.dockerClient.ImageInspect(m.ctx, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect image: %w", err)
+	}
+	if info.Config == nil {
+		return nil, nil
+	}
+
+	metadata, err := parseBuildMetadata(info.Config.Labels)
+	if err != nil || metadata == nil {
+		return nil, err
+	}
+
+	var defaultType string
+	if len(info.Config.Entrypoint) > 0 {
+		defaultType = strings.TrimPrefix(info.Config.Entrypoint[0], processEntrypointDir)
+	}
+
+	processes := make([]ProcessType, 0, len(metadata.Processes))
+	for _, p := range metadata.Processes {
+		process := ProcessType{
+			Type:    p.Type,
+			Args:    p.Args,
+			Direct:  p.Direct,
+			Default: p.Type == defaultType,
+		}
+
+		var command string
+		if err := json.Unmarshal(p.Command, &process.Command); err != nil {
+			if err := json.Unmarshal(p.Command, &command); err == nil && command != "" {
+				process.Command = []string{command}
+			}
+		}
+
+		processes = append(processes, process)
+	}
+	return processes, nil
+}
+
+// entrypoint works out the entrypoint and command for a run. It returns nil
+// slices when the image defaults should be used.
+func (m *RunManager) entrypoint(opts Options) (entrypoint, cmd []string, err error) {
+	switch {
+	case opts.ProcessType != "":
+		processes, err := m.ListProcessTypes(opts.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		found := false
+		var available []string
+		for _, p := range processes {
+			available = append(available, p.Type)
+			found = found || p.Type == opts.ProcessType
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("image %s has no process type %q (available: %s)",
+				opts.Image, opts.ProcessType, strings.Join(available, ", "))
+		}
+		// Extra args are appended to the ones the buildpack defined
+		return []string{processEntrypointDir + opts.ProcessType}, opts.Args, nil
+
+	case len(opts.Command) > 0:
+		if m.isBuildpackImage(opts.Image) {
+			// The launcher sets up the buildpack environment before running the command
+			return []string{cnbLauncher}, append(append([]string{}, opts.Command...), opts.Args...), nil
+		}
+		return opts.Command, opts.Args, nil
+
+	case len(opts.Args) > 0:
+		return nil, opts.Args, nil
+	}
+
+	return nil, nil, nil
+}
+
+func parseBuildMetadata(labels map[string]string) (*buildMetadata, error) {
+	raw, ok := labels[buildMetadataLabel]
+	if !ok {
+		return nil, nil
+	}
+
+	var metadata buildMetadata
+	if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse %s label: %w", buildMetadataLabel, err)
+	}
+	return &metadata, nil
+}
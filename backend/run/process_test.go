@@ -0,0 +1,118 @@
+package run
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// buildpackImage returns the config of a buildpack image with the given
+// io.buildpacks.build.metadata label and default process
+func buildpackImage(metadata, defaultType string) *container.Config {
+	return &container.Config{
+		Entrypoint: []string{processEntrypointDir + defaultType},
+		Labels: map[string]string{
+			lifecycleMetadataLabel: "{}",
+			buildMetadataLabel:     metadata,
+		},
+	}
+}
+
+const webWorkerMetadata = `{
+	"processes": [
+		{"type": "web", "command": ["bundle", "exec", "puma"], "args": ["-p", "8080"], "direct": true},
+		{"type": "worker", "command": "bundle exec sidekiq", "args": []}
+	],
+	"buildpacks": [{"id": "paketo-buildpacks/ruby", "version": "0.1.0"}]
+}`
+
+func TestListProcessTypes(t *testing.T) {
+	m := newTestManager(t, serveImages(map[string]*container.Config{
+		"acme/api": buildpackImage(webWorkerMetadata, "worker"),
+		"postgres": {Labels: map[string]string{}},
+		"broken":   {Labels: map[string]string{buildMetadataLabel: "{"}},
+	}))
+
+	processes, err := m.ListProcessTypes("acme/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProcessType{
+		{Type: "web", Command: []string{"bundle", "exec", "puma"}, Args: []string{"-p", "8080"}, Direct: true},
+		{Type: "worker", Command: []string{"bundle exec sidekiq"}, Args: []string{}, Default: true},
+	}
+	if !reflect.DeepEqual(processes, want) {
+		t.Errorf("got %+v, want %+v", processes, want)
+	}
+
+	if processes, err := m.ListProcessTypes("postgres"); err != nil || processes != nil {
+		t.Errorf("got %v, %v, want no process types for a plain image", processes, err)
+	}
+	if _, err := m.ListProcessTypes("broken"); err == nil {
+		t.Error("expected an error for invalid build metadata")
+	}
+	if _, err := m.ListProcessTypes("missing"); err == nil {
+		t.Error("expected an error for a missing image")
+	}
+}
+
+func TestEntrypoint(t *testing.T) {
+	m := newTestManager(t, serveImages(map[string]*container.Config{
+		"acme/api": buildpackImage(webWorkerMetadata, "web"),
+		"postgres": {Labels: map[string]string{}},
+	}))
+
+	tests := []struct {
+		name           string
+		opts           Options
+		wantEntrypoint []string
+		wantCmd        []string
+		wantErr        bool
+	}{
+		{
+			name: "image defaults",
+			opts: Options{Image: "acme/api"},
+		},
+		{
+			name:           "process type",
+			opts:           Options{Image: "acme/api", ProcessType: "worker", Args: []string{"-q", "mail"}},
+			wantEntrypoint: []string{processEntrypointDir + "worker"},
+			wantCmd:        []string{"-q", "mail"},
+		},
+		{
+			name:    "unknown process type",
+			opts:    Options{Image: "acme/api", ProcessType: "cron"},
+			wantErr: true,
+		},
+		{
+			name:           "command in a buildpack image",
+			opts:           Options{Image: "acme/api", Command: []string{"rake", "db:migrate"}, Args: []string{"--trace"}},
+			wantEntrypoint: []string{cnbLauncher},
+			wantCmd:        []string{"rake", "db:migrate", "--trace"},
+		},
+		{
+			name:           "command in a plain image",
+			opts:           Options{Image: "postgres", Command: []string{"postgres"}, Args: []string{"-c", "fsync=off"}},
+			wantEntrypoint: []string{"postgres"},
+			wantCmd:        []string{"-c", "fsync=off"},
+		},
+		{
+			name:    "args only",
+			opts:    Options{Image: "postgres", Args: []string{"-c", "fsync=off"}},
+			wantCmd: []string{"-c", "fsync=off"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entrypoint, cmd, err := m.entrypoint(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(entrypoint, tt.wantEntrypoint) || !slices.Equal(cmd, tt.wantCmd) {
+				t.Errorf("got %v %v, want %v %v", entrypoint, cmd, tt.wantEntrypoint, tt.wantCmd)
+			}
+		})
+	}
+}
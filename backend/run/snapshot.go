@@ -0,0 +1,152 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Provenance labels added to snapshot images
+const (
+	LabelSnapshotSource = "bskit.snapshot.source"
+	LabelSnapshotRun    = "bskit.snapshot.run"
+	LabelSnapshotTime   = "bskit.snapshot.time"
+	LabelSnapshotUser   = "bskit.snapshot.user"
+)
+
+// Snapshot is an image committed from a run's container
+type Snapshot struct {
+	ImageID     string    `json:"imageId"`
+	Tag         string    `json:"tag"`
+	SourceImage string    `json:"sourceImage"`
+	RunID       string    `json:"runId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	CreatedBy   string    `json:"createdBy"`
+	Size        int64     `json:"size"`
+	// ExportPath is the tarball the image was saved to, if it was exported
+	ExportPath string `json:"exportPath,omitempty"`
+}
+
+// SnapshotRun commits the filesystem of a run's container to a new image,
+// e.g. to hand a reproduced bug to someone else. An empty tag defaults to
+// <image>:snapshot-<time>. When exportPath is set the image is also saved
+// there as a tarball that can be loaded with docker load.
+func (m *RunManager) SnapshotRun(runID, tag, exportPath string) (*Snapshot, error) {
+	run, err := m.Get(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if tag == "" {
+		name, _, _ := strings.Cut(run.Image, "@")
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			name = name[:i]
+		}
+		tag = fmt.Sprintf("%s:snapshot-%s", name, now.Format("20060102-150405"))
+	}
+	createdBy := currentUser()
+
+	resp, err := m.dockerClient.ContainerCommit(m.ctx, run.ContainerID, container.CommitOptions{
+		Reference: tag,
+		Comment:   fmt.Sprintf("Snapshot of bskit run %s", runID),
+		Author:    createdBy,
+		// The container keeps running; pausing avoids a torn filesystem
+		Pause: true,
+		Config: &container.Config{
+			Labels: snapshotLabels(run.Image, runID, createdBy, now),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit container: %w", err)
+	}
+
+	snapshot := &Snapshot{
+		ImageID:     resp.ID,
+		Tag:         tag,
+		SourceImage: run.Image,
+		RunID:       runID,
+		CreatedAt:   now,
+		CreatedBy:   createdBy,
+	}
+	if info, err := m.dockerClient.ImageInspect(m.ctx, resp.ID); err == nil {
+		snapshot.Size = info.Size
+	}
+
+	if exportPath != "" {
+		if err := m.exportImage(tag, exportPath); err != nil {
+			return nil, err
+		}
+		snapshot.ExportPath = exportPath
+	}
+
+	runtime.EventsEmit(m.ctx, "run:snapshot", snapshot)
+	return snapshot, nil
+}
+
+// snapshotLabels returns the labels of a snapshot image. Docker merges the
+// container's labels into the committed config, so bskit's run labels are
+// blanked rather than left out: containers started from the snapshot are not
+// managed runs of the original repo.
+func snapshotLabels(sourceImage, runID, createdBy string, now time.Time) map[string]string {
+	labels := map[string]string{
+		LabelSnapshotSource: sourceImage,
+		LabelSnapshotRun:    runID,
+		LabelSnapshotTime:   now.UTC().Format(time.RFC3339),
+		LabelSnapshotUser:   createdBy,
+	}
+	for _, label := range []string{LabelManaged, LabelRunID, LabelRepo, LabelBranch, LabelEnvironment, LabelService} {
+		labels[label] = ""
+	}
+	return labels
+}
+
+// exportImage saves an image to a tarball, replacing the file only once the
+// export has completed
+func (m *RunManager) exportImage(imageName, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	out, err := m.dockerClient.ImageSave(m.ctx, []string{imageName})
+	if err != nil {
+		return fmt.Errorf("failed to export image: %w", err)
+	}
+	defer out.Close()
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	if _, err := io.Copy(f, out); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotLabels(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	labels := snapshotLabels("acme/api:latest", "run-1", "dev", now)
+
+	want := map[string]string{
+		LabelSnapshotSource: "acme/api:latest",
+		LabelSnapshotRun:    "run-1",
+		LabelSnapshotTime:   "2024-05-01T10:00:00Z",
+		LabelSnapshotUser:   "dev",
+	}
+	for label, value := range want {
+		if labels[label] != value {
+			t.Errorf("%s: got %q, want %q", label, labels[label], value)
+		}
+	}
+
+	// Docker keeps container labels missing from the commit config, so the
+	// run labels must be present and blank
+	for _, label := range []string{LabelManaged, LabelRunID, LabelRepo, LabelBranch, LabelEnvironment, LabelService} {
+		value, ok := labels[label]
+		if !ok || value != "" {
+			t.Errorf("%s: got %q (present %v), want a blank override", label, value, ok)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package run
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// statsHistorySize is the number of samples kept per run, roughly two
+// minutes at the docker sampling rate of one per second
+const statsHistorySize = 120
+
+// StatsSample is a point-in-time view of a run's resource usage, emitted as a
+// run:stats event
+type StatsSample struct {
+	RunID         string    `json:"runId"`
+	Time          time.Time `json:"time"`
+	CPUPercent    float64   `json:"cpuPercent"`
+	MemoryUsage   uint64    `json:"memoryUsage"`
+	MemoryLimit   uint64    `json:"memoryLimit"`
+	MemoryPercent float64   `json:"memoryPercent"`
+	NetworkRx     uint64    `json:"networkRx"`
+	NetworkTx     uint64    `json:"networkTx"`
+	BlockRead     uint64    `json:"blockRead"`
+	BlockWrite    uint64    `json:"blockWrite"`
+	Pids          uint64    `json:"pids"`
+}
+
+// GetStats returns the recent resource usage samples of a run, oldest first
+func (m *RunManager) GetStats(runID string) ([]StatsSample, error) {
+	if _, err := m.Get(runID); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	samples := make([]StatsSample, len(m.stats[runID]))
+	copy(samples, m.stats[runID])
+	return samples, nil
+}
+
+// streamStats samples a run's resource usage until its container stops
+func (m *RunManager) streamStats(run *Run) {
+	resp, err := m.dockerClient.ContainerStats(m.ctx, run.ContainerID, true)
+	if err != nil {
+		log.Printf("Failed to get stats for run %s: %v", run.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var stats container.StatsResponse
+		if err := decoder.Decode(&stats); err != nil {
+			if err != io.EOF && m.ctx.Err() == nil {
+				log.Printf("Error reading stats for run %s: %v", run.ID, err)
+			}
+			return
+		}
+		// The daemon reports empty samples once the container has stopped
+		if stats.Read.IsZero() {
+			return
+		}
+
+		sample := newStatsSample(run.ID, &stats)
+
+		m.mu.Lock()
+		if _, ok := m.runs[run.ID]; !ok {
+			m.mu.Unlock()
+			return
+		}
+		history := append(m.stats[run.ID], sample)
+		if len(history) > statsHistorySize {
+			history = history[len(history)-statsHistorySize:]
+		}
+		m.stats[run.ID] = history
+		m.mu.Unlock()
+
+		runtime.EventsEmit(m.ctx, "run:stats", sample)
+	}
+}
+
+// newStatsSample derives usage figures the same way `docker stats` does
+func newStatsSample(runID string, stats *container.StatsResponse) StatsSample {
+	sample := StatsSample{
+		RunID:       runID,
+		Time:        stats.Read,
+		MemoryLimit: stats.MemoryStats.Limit,
+		Pids:        stats.PidsStats.Current,
+	}
+
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		sample.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	// Page cache is reclaimable, so it is not counted as used memory
+	sample.MemoryUsage = stats.MemoryStats.Usage
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if cache, ok := stats.MemoryStats.Stats[key]; ok && cache < sample.MemoryUsage {
+			sample.MemoryUsage -= cache
+			break
+		}
+	}
+	if sample.MemoryLimit > 0 {
+		sample.MemoryPercent = float64(sample.MemoryUsage) / float64(sample.MemoryLimit) * 100
+	}
+
+	for _, n := range stats.Networks {
+		sample.NetworkRx += n.RxBytes
+		sample.NetworkTx += n.TxBytes
+	}
+
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			sample.BlockRead += entry.Value
+		case "write":
+			sample.BlockWrite += entry.Value
+		}
+	}
+
+	return sample
+}
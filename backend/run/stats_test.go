@@ -0,0 +1,96 @@
+package run
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestNewStatsSample(t *testing.T) {
+	read := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stats := &container.StatsResponse{}
+	stats.Read = read
+	stats.CPUStats.CPUUsage.TotalUsage = 300
+	stats.CPUStats.SystemUsage = 2000
+	stats.CPUStats.OnlineCPUs = 2
+	stats.PreCPUStats.CPUUsage.TotalUsage = 100
+	stats.PreCPUStats.SystemUsage = 1000
+	stats.MemoryStats.Usage = 600
+	stats.MemoryStats.Limit = 1000
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 100}
+	stats.PidsStats.Current = 7
+	stats.Networks = map[string]container.NetworkStats{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+	stats.BlkioStats.IoServiceBytesRecursive = []container.BlkioStatEntry{
+		{Op: "Read", Value: 5},
+		{Op: "Write", Value: 8},
+		{Op: "read", Value: 1},
+		{Op: "Total", Value: 14},
+	}
+
+	got := newStatsSample("run-1", stats)
+	want := StatsSample{
+		RunID:         "run-1",
+		Time:          read,
+		CPUPercent:    40,
+		MemoryUsage:   500,
+		MemoryLimit:   1000,
+		MemoryPercent: 50,
+		NetworkRx:     11,
+		NetworkTx:     22,
+		BlockRead:     6,
+		BlockWrite:    8,
+		Pids:          7,
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNewStatsSampleFallbacks(t *testing.T) {
+	stats := &container.StatsResponse{}
+	// Older daemons only report per-CPU usage
+	stats.CPUStats.CPUUsage.TotalUsage = 200
+	stats.CPUStats.CPUUsage.PercpuUsage = []uint64{100, 100, 0, 0}
+	stats.CPUStats.SystemUsage = 1000
+	// cgroup v1 reports the page cache as total_inactive_file
+	stats.MemoryStats.Usage = 300
+	stats.MemoryStats.Stats = map[string]uint64{"total_inactive_file": 100}
+
+	got := newStatsSample("run-1", stats)
+	if got.CPUPercent != 80 {
+		t.Errorf("got %v%% CPU, want 80%%", got.CPUPercent)
+	}
+	if got.MemoryUsage != 200 {
+		t.Errorf("got %d bytes of memory, want 200", got.MemoryUsage)
+	}
+	if got.MemoryPercent != 0 {
+		t.Errorf("got %v%% memory without a limit, want 0", got.MemoryPercent)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	m := newTestManager(t, func(w http.ResponseWriter, r *http.Request) { notFound(w) })
+	m.runs["run-1"] = &Run{ID: "run-1"}
+	m.stats["run-1"] = []StatsSample{{RunID: "run-1", Pids: 1}, {RunID: "run-1", Pids: 2}}
+
+	samples, err := m.GetStats("run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].Pids != 1 || samples[1].Pids != 2 {
+		t.Fatalf("got %+v, want both samples oldest first", samples)
+	}
+	samples[0].Pids = 99
+	if m.stats["run-1"][0].Pids != 1 {
+		t.Error("GetStats returned the manager's own slice")
+	}
+
+	if _, err := m.GetStats("missing"); err == nil {
+		t.Error("expected an error for an unknown run")
+	}
+}
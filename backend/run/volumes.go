@@ -0,0 +1,211 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+)
+
+// LabelVolume holds the repo-local name of a named volume
+const LabelVolume = "bskit.volume"
+
+// VolumeMount mounts a named volume or a host directory into a run
+type VolumeMount struct {
+	// Name is a named volume, scoped to the run's repo
+	Name string `json:"name,omitempty"`
+	// HostPath is a directory on the host, bind mounted instead of a named volume
+	HostPath string `json:"hostPath,omitempty"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// Volume is a named volume created by bskit
+type Volume struct {
+	// Name is the docker volume name
+	Name string `json:"name"`
+	// DisplayName is the name the volume was requested with
+	DisplayName string `json:"displayName"`
+	Repo        string `json:"repo"`
+	Driver      string `json:"driver"`
+	Mountpoint  string `json:"mountpoint"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// VolumeName returns the docker volume name for a named volume of a repo, so
+// that two repos asking for a "data" volume don't share it. The hash of the
+// repo path keeps repos with the same directory name apart.
+func VolumeName(repo, name string) string {
+	if repo == "" {
+		return "bskit_" + name
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(repo)))
+	return "bskit_" + sanitizeName(filepath.Base(repo)) + "_" + hex.EncodeToString(sum[:4]) + "_" + name
+}
+
+// legacyVolumeName is the name older versions gave the volumes of a repo
+func legacyVolumeName(repo, name string) string {
+	return "bskit_" + sanitizeName(filepath.Base(repo)) + "_" + name
+}
+
+// ListVolumes returns the named volumes bskit created for a repo. An empty
+// repo lists the volumes of every repo.
+func (m *RunManager) ListVolumes(repo string) ([]Volume, error) {
+	args := filters.NewArgs(filters.Arg("label", LabelManaged+"=true"))
+	if repo != "" {
+		args.Add("label", LabelRepo+"="+repo)
+	}
+
+	resp, err := m.dockerClient.VolumeList(m.ctx, volume.ListOptions{Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	volumes := make([]Volume, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		volumes = append(volumes, Volume{
+			Name:        v.Name,
+			DisplayName: v.Labels[LabelVolume],
+			Repo:        v.Labels[LabelRepo],
+			Driver:      v.Driver,
+			Mountpoint:  v.Mountpoint,
+			CreatedAt:   v.CreatedAt,
+		})
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	return volumes, nil
+}
+
+// DeleteVolume removes a named volume created by bskit. Volumes still used by
+// a container are not removed.
+func (m *RunManager) DeleteVolume(name string) error {
+	v, err := m.dockerClient.VolumeInspect(m.ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to inspect volume: %w", err)
+	}
+	if v.Labels[LabelManaged] != "true" {
+		return fmt.Errorf("volume %s is not managed by bskit", name)
+	}
+
+	if err := m.dockerClient.VolumeRemove(m.ctx, name, false); err != nil {
+		if errdefs.IsConflict(err) {
+			return fmt.Errorf("volume %s is in use, stop the runs using it first", name)
+		}
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+	return nil
+}
+
+// mounts creates any missing named volumes and returns the docker mounts for a run
+func (m *RunManager) mounts(opts Options) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, len(opts.Volumes))
+	for _, v := range opts.Volumes {
+		if v.Target == "" {
+			return nil, fmt.Errorf("volume mount without a target")
+		}
+
+		if v.HostPath != "" {
+			source, err := filepath.Abs(v.HostPath)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host path %s: %w", v.HostPath, err)
+			}
+			mounts = append(mounts, mount.Mount{
+				Type:     mount.TypeBind,
+				Source:   source,
+				Target:   v.Target,
+				ReadOnly: v.ReadOnly,
+			})
+			continue
+		}
+
+		if v.Name == "" {
+			return nil, fmt.Errorf("volume mount for %s needs a name or a host path", v.Target)
+		}
+		name, err := m.ensureVolume(opts.Repo, v.Name)
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   name,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		})
+	}
+	return mounts, nil
+}
+
+// ensureVolume creates the named volume of a repo unless it already exists.
+// Existing volumes must belong to the repo.
+func (m *RunManager) ensureVolume(repo, name string) (string, error) {
+	volumeName := VolumeName(repo, name)
+
+	found, err := m.repoVolume(repo, volumeName)
+	if err != nil || found {
+		return volumeName, err
+	}
+	if repo != "" {
+		// Keep using the data of volumes created before names had a hash
+		legacy := legacyVolumeName(repo, name)
+		if found, err := m.repoVolume(repo, legacy); err == nil && found {
+			return legacy, nil
+		}
+	}
+
+	labels := map[string]string{
+		LabelManaged: "true",
+		LabelVolume:  name,
+	}
+	if repo != "" {
+		labels[LabelRepo] = repo
+	}
+	if _, err := m.dockerClient.VolumeCreate(m.ctx, volume.CreateOptions{
+		Name:   volumeName,
+		Labels: labels,
+	}); err != nil {
+		return "", fmt.Errorf("failed to create volume: %w", err)
+	}
+	return volumeName, nil
+}
+
+// repoVolume reports whether a volume exists, failing when it isn't the
+// repo's own volume
+func (m *RunManager) repoVolume(repo, volumeName string) (bool, error) {
+	v, err := m.dockerClient.VolumeInspect(m.ctx, volumeName)
+	if errdefs.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect volume: %w", err)
+	}
+	if v.Labels[LabelManaged] != "true" || v.Labels[LabelRepo] != repo {
+		owner := v.Labels[LabelRepo]
+		if owner == "" {
+			owner = "another project"
+		}
+		return false, fmt.Errorf("volume %s already exists and belongs to %s", volumeName, owner)
+	}
+	return true, nil
+}
+
+// sanitizeName keeps a name within the characters docker allows in volume names
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,142 @@
+package run
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/volume"
+)
+
+func TestVolumeName(t *testing.T) {
+	acme := VolumeName("/src/acme/api", "data")
+	other := VolumeName("/src/other/api", "data")
+	if acme == other {
+		t.Fatalf("repos with the same directory name share volume %s", acme)
+	}
+	if !strings.HasPrefix(acme, "bskit_api_") || !strings.HasSuffix(acme, "_data") {
+		t.Errorf("unexpected volume name %s", acme)
+	}
+	if VolumeName("/src/acme/api/", "data") != acme {
+		t.Error("expected the same name for the same repo path")
+	}
+	if got := VolumeName("", "cache"); got != "bskit_cache" {
+		t.Errorf("got %s, want bskit_cache", got)
+	}
+}
+
+// fakeVolumes serves the docker volume endpoints from a map
+type fakeVolumes struct {
+	mu      sync.Mutex
+	volumes map[string]*volume.Volume
+}
+
+func (f *fakeVolumes) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/volumes/create":
+		var opts volume.CreateOptions
+		json.NewDecoder(r.Body).Decode(&opts)
+		v := &volume.Volume{Name: opts.Name, Labels: opts.Labels, Driver: "local"}
+		f.volumes[opts.Name] = v
+		writeJSON(w, http.StatusCreated, v)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/volumes/"):
+		v, ok := f.volumes[strings.TrimPrefix(r.URL.Path, "/volumes/")]
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.Path, http.StatusInternalServerError)
+	}
+}
+
+func TestEnsureVolume(t *testing.T) {
+	const repo = "/src/acme/api"
+	managed := func(repo string) map[string]string {
+		labels := map[string]string{LabelManaged: "true", LabelVolume: "data"}
+		if repo != "" {
+			labels[LabelRepo] = repo
+		}
+		return labels
+	}
+
+	tests := []struct {
+		name     string
+		existing map[string]*volume.Volume
+		repo     string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "creates a missing volume",
+			repo: repo,
+			want: VolumeName(repo, "data"),
+		},
+		{
+			name:     "reuses the repo's volume",
+			existing: map[string]*volume.Volume{VolumeName(repo, "data"): {Name: VolumeName(repo, "data"), Labels: managed(repo)}},
+			repo:     repo,
+			want:     VolumeName(repo, "data"),
+		},
+		{
+			name:     "keeps using a volume created before names had a hash",
+			existing: map[string]*volume.Volume{"bskit_api_data": {Name: "bskit_api_data", Labels: managed(repo)}},
+			repo:     repo,
+			want:     "bskit_api_data",
+		},
+		{
+			name:     "ignores the legacy volume of another repo",
+			existing: map[string]*volume.Volume{"bskit_api_data": {Name: "bskit_api_data", Labels: managed("/src/other/api")}},
+			repo:     repo,
+			want:     VolumeName(repo, "data"),
+		},
+		{
+			name:     "refuses a volume of another repo",
+			existing: map[string]*volume.Volume{VolumeName(repo, "data"): {Name: VolumeName(repo, "data"), Labels: managed("/src/other/api")}},
+			repo:     repo,
+			wantErr:  true,
+		},
+		{
+			name:     "refuses a volume not created by bskit",
+			existing: map[string]*volume.Volume{"bskit_data": {Name: "bskit_data"}},
+			repo:     "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeVolumes{volumes: map[string]*volume.Volume{}}
+			for name, v := range tt.existing {
+				fake.volumes[name] = v
+			}
+			m := newTestManager(t, fake.serve)
+
+			got, err := m.ensureVolume(tt.repo, "data")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			v, ok := fake.volumes[got]
+			if !ok {
+				t.Fatalf("volume %s was not created", got)
+			}
+			if v.Labels[LabelRepo] != tt.repo || v.Labels[LabelManaged] != "true" {
+				t.Errorf("unexpected labels %v", v.Labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package smoke
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksFile is where the smoke checks of a repo are declared, relative to the repo root
+const checksFile = ".bskit/smoke.json"
+
+// Check is a single HTTP request made against a running app
+type Check struct {
+	Name string `json:"name"`
+	// Method defaults to GET
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	// ExpectStatus defaults to 200
+	ExpectStatus int `json:"expectStatus"`
+	// ExpectBody is a substring the response body must contain
+	ExpectBody string `json:"expectBody"`
+	// ExpectJSON are assertions on a JSON response body
+	ExpectJSON []JSONAssertion `json:"expectJson"`
+	// TimeoutMs bounds the request, 10 seconds by default
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+// JSONAssertion checks the value at a path such as data.items[0].id. Without
+// Equals the value only has to exist.
+type JSONAssertion struct {
+	Path   string      `json:"path"`
+	Equals interface{} `json:"equals,omitempty"`
+}
+
+// LoadChecks reads the smoke checks of a repo. Repos without a checks file have none.
+func LoadChecks(repoPath string) ([]Check, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, checksFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read smoke checks: %w", err)
+	}
+
+	var checks []Check
+	if err := json.Unmarshal(data, &checks); err != nil {
+		return nil, fmt.Errorf("failed to parse smoke checks: %w", err)
+	}
+	if err := validateChecks(checks); err != nil {
+		return nil, fmt.Errorf("invalid smoke checks in %s: %w", checksFile, err)
+	}
+	for i := range checks {
+		checks[i].setDefaults()
+	}
+	return checks, nil
+}
+
+// SaveChecks writes the smoke checks of a repo
+func SaveChecks(repoPath string, checks []Check) error {
+	if err := validateChecks(checks); err != nil {
+		return err
+	}
+
+	path := filepath.Join(repoPath, checksFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create smoke checks directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode smoke checks: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write smoke checks: %w", err)
+	}
+	return nil
+}
+
+// validateChecks requires a name and an absolute path, which is appended to
+// the app address as is
+func validateChecks(checks []Check) error {
+	for _, c := range checks {
+		if c.Name == "" || !strings.HasPrefix(c.Path, "/") {
+			return fmt.Errorf("every check needs a name and a path starting with /")
+		}
+	}
+	return nil
+}
+
+func (c *Check) setDefaults() {
+	if c.Method == "" {
+		c.Method = http.MethodGet
+	}
+	c.Method = strings.ToUpper(c.Method)
+	if c.ExpectStatus == 0 {
+		c.ExpectStatus = http.StatusOK
+	}
+	if c.TimeoutMs == 0 {
+		c.TimeoutMs = 10000
+	}
+}
@@ -0,0 +1,85 @@
+package smoke
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadChecks(t *testing.T) {
+	repo := t.TempDir()
+	if checks, err := LoadChecks(repo); err != nil || checks != nil {
+		t.Fatalf("got %v, %v, want no checks without a checks file", checks, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(repo, ".bskit"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `[
+		{"name": "health", "path": "/health"},
+		{"name": "create", "method": "post", "path": "/items", "expectStatus": 201, "timeoutMs": 500}
+	]`
+	if err := os.WriteFile(filepath.Join(repo, checksFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := LoadChecks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 2 {
+		t.Fatalf("got %d checks, want 2", len(checks))
+	}
+	if c := checks[0]; c.Method != http.MethodGet || c.ExpectStatus != http.StatusOK || c.TimeoutMs != 10000 {
+		t.Errorf("defaults not applied: %+v", c)
+	}
+	if c := checks[1]; c.Method != http.MethodPost || c.ExpectStatus != http.StatusCreated || c.TimeoutMs != 500 {
+		t.Errorf("explicit values not kept: %+v", c)
+	}
+}
+
+func TestLoadChecksInvalid(t *testing.T) {
+	tests := map[string]string{
+		"syntax":         `[{"name": "health"`,
+		"missing name":   `[{"path": "/health"}]`,
+		"relative path":  `[{"name": "health", "path": "health"}]`,
+		"absolute URL":   `[{"name": "health", "path": "http://example.com/health"}]`,
+		"not a list":     `{"name": "health", "path": "/health"}`,
+		"one bad of two": `[{"name": "health", "path": "/health"}, {"name": "", "path": "/"}]`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(repo, ".bskit"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(repo, checksFile), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadChecks(repo); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSaveChecks(t *testing.T) {
+	repo := t.TempDir()
+	checks := []Check{{Name: "health", Path: "/health", ExpectBody: "ok"}}
+	if err := SaveChecks(repo, checks); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadChecks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 1 || loaded[0].Name != "health" || loaded[0].ExpectBody != "ok" {
+		t.Errorf("got %+v after saving %+v", loaded, checks)
+	}
+
+	if err := SaveChecks(repo, []Check{{Name: "bad", Path: "bad"}}); err == nil {
+		t.Error("expected invalid checks to be refused")
+	}
+}
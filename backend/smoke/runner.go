@@ -0,0 +1,324 @@
+package smoke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"bskit/backend/history"
+	"bskit/backend/run"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// startupTimeout bounds how long we wait for a run to become healthy and accept connections
+const startupTimeout = 2 * time.Minute
+
+// maxBodySize caps how much of a response body is read for assertions
+const maxBodySize = 1 << 20
+
+type SmokeRunner struct {
+	ctx        context.Context
+	runManager *run.RunManager
+	history    *history.HistoryStore
+	client     *http.Client
+}
+
+// CheckResult is emitted as a smoke:result event after every check
+type CheckResult struct {
+	RunID      string `json:"runId"`
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Status     int    `json:"status,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Report is emitted as a smoke:finished event once all checks have run
+type Report struct {
+	RunID      string        `json:"runId"`
+	Image      string        `json:"image"`
+	BuildID    string        `json:"buildId,omitempty"`
+	Passed     bool          `json:"passed"`
+	StartedAt  time.Time     `json:"startedAt"`
+	DurationMs int64         `json:"durationMs"`
+	Checks     []CheckResult `json:"checks"`
+	Error      string        `json:"error,omitempty"`
+}
+
+func NewSmokeRunner(ctx context.Context, runManager *run.RunManager, history *history.HistoryStore) *SmokeRunner {
+	return &SmokeRunner{
+		ctx:        ctx,
+		runManager: runManager,
+		history:    history,
+		client: &http.Client{
+			// Redirects are reported as they are so checks can assert on them
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run waits for a run to become healthy and runs the smoke checks declared in
+// repoPath against it. An empty repoPath uses the run's repo. The report is
+// stored with the latest build of the run's image.
+func (s *SmokeRunner) Run(runID, repoPath string) (*Report, error) {
+	r, err := s.runManager.Get(runID)
+	if err != nil {
+		return nil, err
+	}
+	if repoPath == "" {
+		repoPath = r.Repo
+	}
+	if repoPath == "" {
+		return nil, fmt.Errorf("run %s has no repo to load smoke checks from", runID)
+	}
+
+	checks, err := LoadChecks(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("no smoke checks defined in %s", checksFile)
+	}
+
+	report := &Report{
+		RunID:     runID,
+		Image:     r.Image,
+		Passed:    true,
+		StartedAt: time.Now(),
+	}
+
+	address, err := s.waitReady(runID)
+	if err != nil {
+		report.Passed = false
+		report.Error = err.Error()
+	} else {
+		for _, check := range checks {
+			result := s.runCheck(address, check)
+			result.RunID = runID
+			report.Checks = append(report.Checks, result)
+			report.Passed = report.Passed && result.Passed
+			runtime.EventsEmit(s.ctx, "smoke:result", result)
+		}
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	s.record(report)
+	runtime.EventsEmit(s.ctx, "smoke:finished", report)
+	return report, nil
+}
+
+// RunIfDefined runs the smoke checks of a run when its repo declares any, logging
+// instead of returning errors. It is meant to be called in the background after
+// a run starts.
+func (s *SmokeRunner) RunIfDefined(runID, repoPath string) {
+	if repoPath == "" {
+		r, err := s.runManager.Get(runID)
+		if err != nil {
+			return
+		}
+		repoPath = r.Repo
+	}
+	if repoPath == "" {
+		return
+	}
+	if checks, err := LoadChecks(repoPath); err != nil || len(checks) == 0 {
+		return
+	}
+
+	if _, err := s.Run(runID, repoPath); err != nil {
+		log.Printf("Failed to run smoke checks for %s: %v", runID, err)
+	}
+}
+
+// waitReady waits for the run's health check to pass and its published port
+// to accept connections, returning the address to send requests to
+func (s *SmokeRunner) waitReady(runID string) (string, error) {
+	deadline := time.Now().Add(startupTimeout)
+	if err := s.runManager.WaitHealthy(runID, startupTimeout); err != nil {
+		return "", err
+	}
+
+	address, err := s.runManager.HostPort(runID)
+	if err != nil {
+		return "", err
+	}
+
+	// Containers without a health check count as healthy as soon as they
+	// start, which is usually before the app is listening
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return address, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("app did not start listening on %s: %w", address, err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return "", s.ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (s *SmokeRunner) runCheck(address string, check Check) CheckResult {
+	result := CheckResult{Name: check.Name}
+	start := time.Now()
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(check.TimeoutMs)*time.Millisecond)
+	defer cancel()
+
+	var body io.Reader
+	if check.Body != "" {
+		body = strings.NewReader(check.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, check.Method, "http://"+address+check.Path, body)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid request: %v", err)
+		return result
+	}
+	for k, v := range check.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		result.Error = fmt.Sprintf("request failed: %v", err)
+		return result
+	}
+	defer resp.Body.Close()
+	result.Status = resp.StatusCode
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to read response: %v", err)
+		return result
+	}
+
+	if err := assert(check, resp.StatusCode, data); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// assert checks a response against the expectations of a check
+func assert(check Check, status int, body []byte) error {
+	if status != check.ExpectStatus {
+		return fmt.Errorf("expected status %d, got %d", check.ExpectStatus, status)
+	}
+	if check.ExpectBody != "" && !bytes.Contains(body, []byte(check.ExpectBody)) {
+		return fmt.Errorf("response body does not contain %q", check.ExpectBody)
+	}
+	if len(check.ExpectJSON) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("response is not valid JSON: %v", err)
+	}
+	for _, a := range check.ExpectJSON {
+		value, ok := lookup(doc, a.Path)
+		if !ok {
+			return fmt.Errorf("%s not found in response", a.Path)
+		}
+		if a.Equals != nil && !reflect.DeepEqual(value, normalize(a.Equals)) {
+			return fmt.Errorf("%s: expected %v, got %v", a.Path, a.Equals, value)
+		}
+	}
+	return nil
+}
+
+// lookup resolves a path such as data.items[0].id in a decoded JSON document
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	if path == "" {
+		return doc, true
+	}
+
+	value := doc
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// normalize round-trips an expected value through JSON so numbers compare
+// equal to the float64s produced when decoding responses
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// record stores a report with the latest build of the run's image
+func (s *SmokeRunner) record(report *Report) {
+	build, err := s.history.LatestForImage(report.Image)
+	if err != nil {
+		return
+	}
+	report.BuildID = build.ID
+
+	result := history.SmokeResult{
+		RunID:      report.RunID,
+		Passed:     report.Passed,
+		StartedAt:  report.StartedAt,
+		DurationMs: report.DurationMs,
+	}
+	if report.Error != "" {
+		result.Checks = append(result.Checks, history.CheckResult{Name: "startup", Error: report.Error})
+	}
+	for _, c := range report.Checks {
+		result.Checks = append(result.Checks, history.CheckResult{
+			Name:       c.Name,
+			Passed:     c.Passed,
+			Status:     c.Status,
+			DurationMs: c.DurationMs,
+			Error:      c.Error,
+		})
+	}
+	if err := s.history.AddSmokeResult(build.ID, result); err != nil {
+		log.Printf("Failed to record smoke result: %v", err)
+	}
+}
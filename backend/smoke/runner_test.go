@@ -0,0 +1,161 @@
+package smoke
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	doc := map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"id": float64(1)},
+				map[string]interface{}{"id": float64(2)},
+			},
+		},
+		"ok": true,
+	}
+	tests := []struct {
+		path   string
+		want   interface{}
+		wantOK bool
+	}{
+		{path: "ok", want: true, wantOK: true},
+		{path: "$.ok", want: true, wantOK: true},
+		{path: "data.items[1].id", want: float64(2), wantOK: true},
+		{path: "data.items.0.id", want: float64(1), wantOK: true},
+		{path: "data.items[2].id"},
+		{path: "data.items[-1]"},
+		{path: "data.missing"},
+		{path: "ok.nested"},
+	}
+	for _, tt := range tests {
+		got, ok := lookup(doc, tt.path)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAssert(t *testing.T) {
+	body := []byte(`{"status": "ok", "count": 3, "tags": ["a", "b"]}`)
+	tests := []struct {
+		name    string
+		check   Check
+		status  int
+		body    []byte
+		wantErr bool
+	}{
+		{name: "status", check: Check{ExpectStatus: 200}, status: 200, body: body},
+		{name: "wrong status", check: Check{ExpectStatus: 200}, status: 500, body: body, wantErr: true},
+		{name: "body", check: Check{ExpectStatus: 200, ExpectBody: `"ok"`}, status: 200, body: body},
+		{name: "missing body", check: Check{ExpectStatus: 200, ExpectBody: "error"}, status: 200, body: body, wantErr: true},
+		{
+			name:   "json",
+			check:  Check{ExpectStatus: 200, ExpectJSON: []JSONAssertion{{Path: "status", Equals: "ok"}, {Path: "count", Equals: 3}, {Path: "tags", Equals: []string{"a", "b"}}}},
+			status: 200, body: body,
+		},
+		{
+			name:   "json exists",
+			check:  Check{ExpectStatus: 200, ExpectJSON: []JSONAssertion{{Path: "tags[1]"}}},
+			status: 200, body: body,
+		},
+		{
+			name:   "json mismatch",
+			check:  Check{ExpectStatus: 200, ExpectJSON: []JSONAssertion{{Path: "count", Equals: 4}}},
+			status: 200, body: body, wantErr: true,
+		},
+		{
+			name:   "json missing",
+			check:  Check{ExpectStatus: 200, ExpectJSON: []JSONAssertion{{Path: "tags[2]"}}},
+			status: 200, body: body, wantErr: true,
+		},
+		{
+			name:   "not json",
+			check:  Check{ExpectStatus: 200, ExpectJSON: []JSONAssertion{{Path: "status"}}},
+			status: 200, body: []byte("<html>"), wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := assert(tt.check, tt.status, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/items":
+			data, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write(data)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "http://")
+	s := NewSmokeRunner(context.Background(), nil, nil)
+
+	tests := []struct {
+		name       string
+		check      Check
+		wantPassed bool
+		wantStatus int
+	}{
+		{
+			name: "request with body and headers",
+			check: Check{
+				Name: "create", Method: http.MethodPost, Path: "/items",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+				Body:    `{"id": 7}`, ExpectStatus: http.StatusCreated,
+				ExpectJSON: []JSONAssertion{{Path: "id", Equals: 7}},
+			},
+			wantPassed: true,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "redirects are not followed",
+			check:      Check{Name: "old", Path: "/old", ExpectStatus: http.StatusMovedPermanently},
+			wantPassed: true,
+			wantStatus: http.StatusMovedPermanently,
+		},
+		{
+			name:       "unexpected status",
+			check:      Check{Name: "missing", Path: "/missing", ExpectStatus: http.StatusOK},
+			wantStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.setDefaults()
+			result := s.runCheck(address, tt.check)
+			if result.Passed != tt.wantPassed || result.Status != tt.wantStatus {
+				t.Errorf("got %+v, want passed %v with status %d", result, tt.wantPassed, tt.wantStatus)
+			}
+			if result.Name != tt.check.Name {
+				t.Errorf("got name %s, want %s", result.Name, tt.check.Name)
+			}
+		})
+	}
+
+	srv.Close()
+	result := s.runCheck(address, Check{Name: "down", Path: "/", Method: http.MethodGet, ExpectStatus: http.StatusOK, TimeoutMs: 1000})
+	if result.Passed || result.Error == "" {
+		t.Errorf("got %+v, want a failed request", result)
+	}
+}
@@ -0,0 +1,110 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// alwaysIgnored are never worth rebuilding for
+var alwaysIgnored = []string{".git", ".bskit", "node_modules/.cache"}
+
+// projectDescriptor is the part of project.toml that controls which files
+// make it into the build. Both the v0.1 ([build]) and v0.2 ([io.buildpacks])
+// layouts are supported.
+type projectDescriptor struct {
+	Build struct {
+		Include []string `toml:"include"`
+		Exclude []string `toml:"exclude"`
+	} `toml:"build"`
+	IO struct {
+		Buildpacks struct {
+			Include []string `toml:"include"`
+			Exclude []string `toml:"exclude"`
+		} `toml:"buildpacks"`
+	} `toml:"io"`
+}
+
+// includeMatcher additionally ignores files that match none of the includes
+// from project.toml. Directories are left to the ignore patterns, as pack
+// still walks into them looking for included files.
+type includeMatcher struct {
+	ignore  gitignore.Matcher
+	include gitignore.Matcher
+}
+
+func (m includeMatcher) Match(path []string, isDir bool) bool {
+	if m.ignore.Match(path, isDir) {
+		return true
+	}
+	return !isDir && !m.include.Match(path, false)
+}
+
+// loadIgnoreMatcher combines the .gitignore files of the tree with the
+// includes or excludes from project.toml into a single matcher
+func loadIgnoreMatcher(root string) (gitignore.Matcher, error) {
+	patterns, err := gitignore.ReadPatterns(osfs.New(root), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitignore files: %w", err)
+	}
+
+	for _, p := range alwaysIgnored {
+		patterns = append(patterns, gitignore.ParsePattern(p, nil))
+	}
+
+	includes, excludes, err := projectFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range excludes {
+		patterns = append(patterns, gitignore.ParsePattern(p, nil))
+	}
+	matcher := gitignore.NewMatcher(patterns)
+	if len(includes) == 0 {
+		return matcher, nil
+	}
+
+	var include []gitignore.Pattern
+	for _, p := range includes {
+		include = append(include, gitignore.ParsePattern(p, nil))
+	}
+	return includeMatcher{ignore: matcher, include: gitignore.NewMatcher(include)}, nil
+}
+
+// projectFiles returns the include and exclude patterns declared in
+// project.toml. Like pack, it refuses descriptors that set both.
+func projectFiles(root string) (includes, excludes []string, err error) {
+	data, err := os.ReadFile(filepath.Join(root, "project.toml"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("failed to read project.toml: %w", err)
+	}
+
+	var descriptor projectDescriptor
+	if err := toml.Unmarshal(data, &descriptor); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse project.toml: %w", err)
+	}
+
+	includes = append(descriptor.Build.Include, descriptor.IO.Buildpacks.Include...)
+	excludes = append(descriptor.Build.Exclude, descriptor.IO.Buildpacks.Exclude...)
+	if len(includes) > 0 && len(excludes) > 0 {
+		return nil, nil, fmt.Errorf("project.toml cannot have both include and exclude defined")
+	}
+	return includes, excludes, nil
+}
+
+// splitPath turns a path relative to root into the components gitignore matchers expect
+func splitPath(root, path string) []string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		ignored []string
+		watched []string
+		dirs    []string
+	}{
+		{
+			name:    "gitignore and defaults",
+			files:   map[string]string{".gitignore": "dist/\n*.log\n"},
+			ignored: []string{".git/index", "dist/app.js", "debug.log", "node_modules/.cache/x"},
+			watched: []string{"main.go", "src/app.js"},
+		},
+		{
+			name: "excludes",
+			files: map[string]string{"project.toml": `
+[build]
+exclude = ["docs/"]
+`},
+			ignored: []string{"docs/readme.md"},
+			watched: []string{"main.go"},
+		},
+		{
+			name: "v0.1 includes",
+			files: map[string]string{"project.toml": `
+[build]
+include = ["src/", "*.go"]
+`},
+			ignored: []string{"README.md", "docs/readme.md"},
+			watched: []string{"main.go", "src/app.js", "src/lib/util.js", "cmd/tool/main.go"},
+			dirs:    []string{"docs", "cmd/tool"},
+		},
+		{
+			name: "v0.2 includes",
+			files: map[string]string{".gitignore": "src/gen/\n", "project.toml": `
+[_]
+schema-version = "0.2"
+
+[io.buildpacks]
+include = ["src/"]
+`},
+			ignored: []string{"main.go", "src/gen/api.js"},
+			watched: []string{"src/app.js"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, tt.files)
+
+			matcher, err := loadIgnoreMatcher(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range tt.ignored {
+				if !matcher.Match(splitPath(root, filepath.Join(root, path)), false) {
+					t.Errorf("%s should be ignored", path)
+				}
+			}
+			for _, path := range tt.watched {
+				if matcher.Match(splitPath(root, filepath.Join(root, path)), false) {
+					t.Errorf("%s should be watched", path)
+				}
+			}
+			for _, dir := range tt.dirs {
+				if matcher.Match(splitPath(root, filepath.Join(root, dir)), true) {
+					t.Errorf("directory %s should be walked", dir)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadIgnoreMatcherIncludeAndExclude(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"project.toml": `
+[build]
+include = ["src/"]
+exclude = ["docs/"]
+`})
+
+	if _, err := loadIgnoreMatcher(root); err == nil {
+		t.Error("expected an error for both include and exclude")
+	}
+}
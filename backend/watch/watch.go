@@ -0,0 +1,342 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"bskit/backend/pack"
+	"bskit/backend/run"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const defaultDebounce = 500 * time.Millisecond
+
+// Cycle phases reported in watch:cycle events
+const (
+	PhaseBuilding   = "building"
+	PhaseRestarting = "restarting"
+	PhaseReady      = "ready"
+	PhaseFailed     = "failed"
+)
+
+type WatchManager struct {
+	ctx         context.Context
+	packBuilder *pack.PackBuilder
+	runManager  *run.RunManager
+	mu          sync.Mutex
+	watches     map[string]*watchSession
+}
+
+// Options configures a watch
+type Options struct {
+	Path     string `json:"path"`
+	Platform string `json:"platform"`
+	// RunID is the run restarted after every successful build, if any
+	RunID string `json:"runId"`
+	// DebounceMs is how long the tree has to be quiet before a build starts
+	DebounceMs int `json:"debounceMs"`
+}
+
+// Watch describes an active watch
+type Watch struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Platform  string    `json:"platform"`
+	RunID     string    `json:"runId"`
+	Cycles    int       `json:"cycles"`
+	Building  bool      `json:"building"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// Cycle is emitted as a watch:cycle event as a rebuild progresses
+type Cycle struct {
+	WatchID  string   `json:"watchId"`
+	Cycle    int      `json:"cycle"`
+	Phase    string   `json:"phase"`
+	Changes  []string `json:"changes,omitempty"`
+	RunID    string   `json:"runId,omitempty"`
+	Duration int64    `json:"durationMs,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type watchSession struct {
+	Watch
+	debounce time.Duration
+	watcher  *fsnotify.Watcher
+	matcher  gitignore.Matcher
+	cancel   context.CancelFunc
+	trigger  chan struct{}
+	mu       sync.Mutex
+	pending  map[string]struct{}
+}
+
+func NewWatchManager(ctx context.Context, packBuilder *pack.PackBuilder, runManager *run.RunManager) *WatchManager {
+	return &WatchManager{
+		ctx:         ctx,
+		packBuilder: packBuilder,
+		runManager:  runManager,
+		watches:     make(map[string]*watchSession),
+	}
+}
+
+// Start watches a source tree and rebuilds it whenever it changes
+func (m *WatchManager) Start(opts Options) (*Watch, error) {
+	absPath, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if opts.Platform != "arm64" && opts.Platform != "amd64" {
+		return nil, fmt.Errorf("invalid platform: %s", opts.Platform)
+	}
+
+	m.mu.Lock()
+	for _, w := range m.watches {
+		if w.Path == absPath {
+			m.mu.Unlock()
+			return nil, fmt.Errorf("%s is already being watched", absPath)
+		}
+	}
+	m.mu.Unlock()
+
+	matcher, err := loadIgnoreMatcher(absPath)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+
+	debounce := defaultDebounce
+	if opts.DebounceMs > 0 {
+		debounce = time.Duration(opts.DebounceMs) * time.Millisecond
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	s := &watchSession{
+		Watch: Watch{
+			ID:        fmt.Sprintf("%x", time.Now().UnixNano()),
+			Path:      absPath,
+			Platform:  opts.Platform,
+			RunID:     opts.RunID,
+			StartedAt: time.Now(),
+		},
+		debounce: debounce,
+		watcher:  watcher,
+		matcher:  matcher,
+		cancel:   cancel,
+		trigger:  make(chan struct{}, 1),
+		pending:  make(map[string]struct{}),
+	}
+
+	if err := s.addTree(absPath); err != nil {
+		watcher.Close()
+		cancel()
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.watches[s.ID] = s
+	m.mu.Unlock()
+
+	go m.watchEvents(ctx, s)
+	go m.buildLoop(ctx, s)
+
+	w := s.snapshot()
+	runtime.EventsEmit(m.ctx, "watch:started", w)
+	return w, nil
+}
+
+// Stop ends a watch. A build already in progress is allowed to finish.
+func (m *WatchManager) Stop(watchID string) error {
+	m.mu.Lock()
+	s, ok := m.watches[watchID]
+	delete(m.watches, watchID)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("watch not found: %s", watchID)
+	}
+
+	s.cancel()
+	if err := s.watcher.Close(); err != nil {
+		log.Printf("Failed to close file watcher: %v", err)
+	}
+
+	runtime.EventsEmit(m.ctx, "watch:stopped", watchID)
+	return nil
+}
+
+// List returns the active watches
+func (m *WatchManager) List() []*Watch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	watches := make([]*Watch, 0, len(m.watches))
+	for _, s := range m.watches {
+		watches = append(watches, s.snapshot())
+	}
+	sort.Slice(watches, func(i, j int) bool {
+		return watches[i].StartedAt.Before(watches[j].StartedAt)
+	})
+	return watches
+}
+
+// watchEvents collects file changes and fires the trigger once the tree has
+// been quiet for the debounce period
+func (m *WatchManager) watchEvents(ctx context.Context, s *watchSession) {
+	timer := time.NewTimer(s.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			info, statErr := os.Stat(event.Name)
+			isDir := statErr == nil && info.IsDir()
+			if s.matcher.Match(splitPath(s.Path, event.Name), isDir) {
+				continue
+			}
+			if isDir && event.Has(fsnotify.Create) {
+				if err := s.addTree(event.Name); err != nil {
+					log.Printf("Failed to watch %s: %v", event.Name, err)
+				}
+			}
+
+			rel, _ := filepath.Rel(s.Path, event.Name)
+			s.mu.Lock()
+			s.pending[filepath.ToSlash(rel)] = struct{}{}
+			s.mu.Unlock()
+			timer.Reset(s.debounce)
+
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error for %s: %v", s.Path, err)
+
+		case <-timer.C:
+			select {
+			case s.trigger <- struct{}{}:
+			default:
+				// A build is already queued and will pick these changes up
+			}
+		}
+	}
+}
+
+// buildLoop runs one build cycle per trigger, so changes made while a build
+// is running queue exactly one follow-up build
+func (m *WatchManager) buildLoop(ctx context.Context, s *watchSession) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.trigger:
+			m.runCycle(s)
+		}
+	}
+}
+
+func (m *WatchManager) runCycle(s *watchSession) {
+	s.mu.Lock()
+	changes := make([]string, 0, len(s.pending))
+	for path := range s.pending {
+		changes = append(changes, path)
+	}
+	s.pending = make(map[string]struct{})
+	s.Cycles++
+	s.Building = true
+	cycle := s.Cycles
+	runID := s.RunID
+	s.mu.Unlock()
+	sort.Strings(changes)
+
+	defer func() {
+		s.mu.Lock()
+		s.Building = false
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	emit := func(c Cycle) {
+		c.WatchID = s.ID
+		c.Cycle = cycle
+		c.Duration = time.Since(start).Milliseconds()
+		runtime.EventsEmit(m.ctx, "watch:cycle", c)
+	}
+
+	emit(Cycle{Phase: PhaseBuilding, Changes: changes})
+	err := m.packBuilder.BuildWithOptions(pack.BuildOptions{
+		Path:     s.Path,
+		Platform: s.Platform,
+		// The builder image only needs pulling once per session
+		PullPolicy: "if-not-present",
+	})
+	if err != nil {
+		emit(Cycle{Phase: PhaseFailed, Error: err.Error()})
+		return
+	}
+
+	if runID != "" {
+		emit(Cycle{Phase: PhaseRestarting, RunID: runID})
+		r, err := m.runManager.Restart(runID)
+		if err != nil {
+			emit(Cycle{Phase: PhaseFailed, RunID: runID, Error: err.Error()})
+			return
+		}
+		runID = r.ID
+
+		s.mu.Lock()
+		s.RunID = runID
+		s.mu.Unlock()
+	}
+
+	emit(Cycle{Phase: PhaseReady, RunID: runID})
+}
+
+// addTree adds a directory and all of its non-ignored subdirectories to the watcher
+func (s *watchSession) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != s.Path && s.matcher.Match(splitPath(s.Path, path), true) {
+			return filepath.SkipDir
+		}
+		if err := s.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func (s *watchSession) snapshot() *Watch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.Watch
+	return &w
+}
@@ -0,0 +1,113 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestSession watches root without building, so tests can observe the
+// trigger and pending changes directly
+func newTestSession(t *testing.T, root string) *watchSession {
+	t.Helper()
+	matcher, err := loadIgnoreMatcher(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { watcher.Close() })
+
+	s := &watchSession{
+		Watch:    Watch{Path: root},
+		debounce: 50 * time.Millisecond,
+		watcher:  watcher,
+		matcher:  matcher,
+		trigger:  make(chan struct{}, 1),
+		pending:  make(map[string]struct{}),
+	}
+	if err := s.addTree(root); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAddTree(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":                "dist/\n",
+		"src/app.js":                "",
+		"src/lib/util.js":           "",
+		"dist/app.js":               "",
+		".git/HEAD":                 "",
+		"node_modules/.cache/x":     "",
+		"node_modules/pkg/index.js": "",
+	})
+	s := newTestSession(t, root)
+
+	var got []string
+	for _, path := range s.watcher.WatchList() {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	slices.Sort(got)
+	want := []string{".", "node_modules", "node_modules/pkg", "src", "src/lib"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{".gitignore": "*.log\n", "main.go": ""})
+	s := newTestSession(t, root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &WatchManager{}
+	go m.watchEvents(ctx, s)
+
+	// Ignored files never trigger a build
+	writeFiles(t, root, map[string]string{"debug.log": "x"})
+	select {
+	case <-s.trigger:
+		t.Fatal("build triggered by an ignored file")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// New directories are watched as soon as they show up
+	writeFiles(t, root, map[string]string{"main.go": "package main"})
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitTrigger(t, s)
+	writeFiles(t, root, map[string]string{"pkg/util.go": "package pkg"})
+	waitTrigger(t, s)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, want := range []string{"main.go", "pkg", "pkg/util.go"} {
+		if _, ok := s.pending[want]; !ok {
+			t.Errorf("%s missing from pending changes %v", want, s.pending)
+		}
+	}
+	if _, ok := s.pending["debug.log"]; ok {
+		t.Error("ignored file recorded as a change")
+	}
+}
+
+func waitTrigger(t *testing.T, s *watchSession) {
+	t.Helper()
+	select {
+	case <-s.trigger:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no build triggered")
+	}
+}